@@ -0,0 +1,94 @@
+// Package dashboard holds the widget layout of the organization dashboards.
+package dashboard
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrNotFound = errors.New("dashboard not found")
+
+type WidgetResponse struct {
+	Key    string `json:"key"`
+	StartX int    `json:"startX"`
+	StartY int    `json:"startY"`
+	SizeX  int    `json:"sizeX"`
+	SizeY  int    `json:"sizeY"`
+}
+
+type CreateDashboardRequest struct {
+	GroupName string           `json:"groupName"`
+	SizeX     int              `json:"sizeX"`
+	SizeY     int              `json:"sizeY"`
+	Widgets   []WidgetResponse `json:"widgets"`
+}
+
+// Validate checks that every group is named and sized and that its widgets have a key,
+// a non-negative position and a positive size.
+func Validate(groups []CreateDashboardRequest) error {
+	var errs []error
+	for i, group := range groups {
+		if group.GroupName == "" {
+			errs = append(errs, fmt.Errorf("[%d].groupName is required", i))
+		}
+		if group.SizeX <= 0 || group.SizeY <= 0 {
+			errs = append(errs, fmt.Errorf("[%d] size must be positive", i))
+		}
+		for j, widget := range group.Widgets {
+			switch {
+			case widget.Key == "":
+				errs = append(errs, fmt.Errorf("[%d].widgets[%d].key is required", i, j))
+			case widget.StartX < 0 || widget.StartY < 0:
+				errs = append(errs, fmt.Errorf("[%d].widgets[%d] %s: start must not be negative", i, j, widget.Key))
+			case widget.SizeX <= 0 || widget.SizeY <= 0:
+				errs = append(errs, fmt.Errorf("[%d].widgets[%d] %s: size must be positive", i, j, widget.Key))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Store keeps the dashboard of every organization
+type Store interface {
+	Get(organization string) ([]CreateDashboardRequest, error)
+	Put(organization string, groups []CreateDashboardRequest) error
+}
+
+// MemoryStore is a Store which keeps the dashboards in memory, they are lost on restart
+type MemoryStore struct {
+	mu         sync.RWMutex
+	dashboards map[string][]CreateDashboardRequest
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{dashboards: make(map[string][]CreateDashboardRequest)}
+}
+
+func (s *MemoryStore) Get(organization string) ([]CreateDashboardRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	groups, ok := s.dashboards[organization]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, organization)
+	}
+	return copyGroups(groups), nil
+}
+
+func (s *MemoryStore) Put(organization string, groups []CreateDashboardRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dashboards[organization] = copyGroups(groups)
+	return nil
+}
+
+func copyGroups(groups []CreateDashboardRequest) []CreateDashboardRequest {
+	out := make([]CreateDashboardRequest, len(groups))
+	for i, group := range groups {
+		out[i] = group
+		out[i].Widgets = append([]WidgetResponse(nil), group.Widgets...)
+	}
+	return out
+}
@@ -0,0 +1,278 @@
+package embed
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Node is a node of the abstract syntax tree of a parsed expression.
+// Nodes are immutable, so a parsed expression can be evaluated many times and concurrently.
+type Node interface {
+	// Pos is the 1-based column of the node in the expression: the operator of an operation,
+	// the name of a call or an assignment and the first character of a number or a variable
+	Pos() int
+	// String is the canonical form of the node, see Format
+	String() string
+
+	node()
+}
+
+// NumberNode is a number literal
+type NumberNode struct {
+	col   int
+	text  string
+	value float64
+}
+
+// VariableNode is a variable reference, _ is the previous result of a session
+type VariableNode struct {
+	col  int
+	name string
+}
+
+// AssignNode binds the value of an expression to a variable, it is only the root of an expression
+type AssignNode struct {
+	col   int
+	name  string
+	value Node
+}
+
+// CallNode is a function call
+type CallNode struct {
+	col  int
+	name string
+	args []Node
+}
+
+// UnaryNode is a sign, Op is '-' or '+'
+type UnaryNode struct {
+	col     int
+	op      byte
+	operand Node
+}
+
+// BinaryNode is an operation, Op is one of + - * / % ^
+type BinaryNode struct {
+	col         int
+	op          byte
+	left, right Node
+}
+
+func (n *NumberNode) Pos() int   { return n.col }
+func (n *VariableNode) Pos() int { return n.col }
+func (n *AssignNode) Pos() int   { return n.col }
+func (n *CallNode) Pos() int     { return n.col }
+func (n *UnaryNode) Pos() int    { return n.col }
+func (n *BinaryNode) Pos() int   { return n.col }
+
+func (n *NumberNode) String() string   { return Format(n) }
+func (n *VariableNode) String() string { return Format(n) }
+func (n *AssignNode) String() string   { return Format(n) }
+func (n *CallNode) String() string     { return Format(n) }
+func (n *UnaryNode) String() string    { return Format(n) }
+func (n *BinaryNode) String() string   { return Format(n) }
+
+func (*NumberNode) node()   {}
+func (*VariableNode) node() {}
+func (*AssignNode) node()   {}
+func (*CallNode) node()     {}
+func (*UnaryNode) node()    {}
+func (*BinaryNode) node()   {}
+
+// Value is the value of the number
+func (n *NumberNode) Value() float64 { return n.value }
+
+// Text is the number as written in the expression
+func (n *NumberNode) Text() string { return n.text }
+
+func (n *VariableNode) Name() string { return n.name }
+
+func (n *AssignNode) Name() string { return n.name }
+func (n *AssignNode) Value() Node  { return n.value }
+
+func (n *CallNode) Name() string { return n.name }
+
+// Args returns a copy of the arguments
+func (n *CallNode) Args() []Node { return append([]Node(nil), n.args...) }
+
+func (n *UnaryNode) Op() byte      { return n.op }
+func (n *UnaryNode) Operand() Node { return n.operand }
+
+func (n *BinaryNode) Op() byte    { return n.op }
+func (n *BinaryNode) Left() Node  { return n.left }
+func (n *BinaryNode) Right() Node { return n.right }
+
+// Parse parses an expression once, so that it can be evaluated many times with Eval
+func Parse(expression string) (Node, error) {
+	return parse(expression)
+}
+
+// Env is the variables of an evaluation
+type Env interface {
+	Get(name string) (float64, bool)
+}
+
+// Vars is an Env of a map, assignments bind variables in it
+type Vars map[string]float64
+
+func (v Vars) Get(name string) (float64, bool) {
+	value, ok := v[name]
+	return value, ok
+}
+
+func (v Vars) Set(name string, value float64) {
+	v[name] = value
+}
+
+// Eval evaluates a parsed expression with the variables of env and the built-in functions
+func Eval(n Node, env Env) (float64, error) {
+	return ArithmeticResolver{}.Eval(n, env)
+}
+
+// precedence of the nodes, from the loosest to the tightest
+const (
+	precAssign = iota
+	precSum
+	precProduct
+	precUnary
+	precPower
+	precPrimary
+)
+
+func precedence(n Node) int {
+	switch n := n.(type) {
+	case *AssignNode:
+		return precAssign
+	case *UnaryNode:
+		return precUnary
+	case *NumberNode:
+		// a folded negative number is written as a sign
+		if math.Signbit(n.value) {
+			return precUnary
+		}
+	case *BinaryNode:
+		switch n.op {
+		case '+', '-':
+			return precSum
+		case '*', '/', '%':
+			return precProduct
+		case '^':
+			return precPower
+		}
+	}
+	return precPrimary
+}
+
+// Format returns the canonical form of a node: numbers in their shortest form, a space around
+// binary operators and assignments, ", " between arguments and only the parentheses the grammar needs.
+// Parsing the canonical form of a parsed expression gives the same tree. A folded expression may have
+// negative numbers, which parse back as a negated number: the tree differs but evaluates to the same value.
+func Format(n Node) string {
+	var b strings.Builder
+	format(&b, n)
+	return b.String()
+}
+
+func format(b *strings.Builder, n Node) {
+	switch n := n.(type) {
+	case *NumberNode:
+		b.WriteString(strconv.FormatFloat(n.value, 'g', -1, 64))
+	case *VariableNode:
+		b.WriteString(n.name)
+	case *AssignNode:
+		b.WriteString(n.name)
+		b.WriteString(" = ")
+		format(b, n.value)
+	case *CallNode:
+		b.WriteString(n.name)
+		b.WriteByte('(')
+		for i, arg := range n.args {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			format(b, arg)
+		}
+		b.WriteByte(')')
+	case *UnaryNode:
+		b.WriteByte(n.op)
+		formatOperand(b, n.operand, precedence(n.operand) < precUnary)
+	case *BinaryNode:
+		prec := precedence(n)
+		if n.op == '^' {
+			// right associative, the exponent is a unary
+			formatOperand(b, n.left, precedence(n.left) <= prec)
+			b.WriteString(" ^ ")
+			formatOperand(b, n.right, precedence(n.right) < precUnary)
+			return
+		}
+		formatOperand(b, n.left, precedence(n.left) < prec)
+		b.WriteByte(' ')
+		b.WriteByte(n.op)
+		b.WriteByte(' ')
+		formatOperand(b, n.right, precedence(n.right) <= prec)
+	}
+}
+
+func formatOperand(b *strings.Builder, n Node, parenthesize bool) {
+	if parenthesize {
+		b.WriteByte('(')
+	}
+	format(b, n)
+	if parenthesize {
+		b.WriteByte(')')
+	}
+}
+
+// Fold evaluates the constant subexpressions of a parsed expression with the built-in functions
+func Fold(n Node) Node {
+	return ArithmeticResolver{}.Fold(n)
+}
+
+// Fold replaces the constant subexpressions of n with their value, a folded node keeps the position
+// of the node it replaces. Calls of Functions are not folded since they may not be pure, and
+// subexpressions which fail, such as 1 / 0, are kept so that evaluating them reports the error.
+func (r ArithmeticResolver) Fold(n Node) Node {
+	var folded Node
+	constant := true
+	switch n := n.(type) {
+	case *NumberNode, *VariableNode:
+		return n
+	case *AssignNode:
+		return &AssignNode{col: n.col, name: n.name, value: r.Fold(n.value)}
+	case *CallNode:
+		args := make([]Node, len(n.args))
+		for i, arg := range n.args {
+			args[i] = r.Fold(arg)
+			constant = constant && isNumber(args[i])
+		}
+		_, custom := r.Functions[n.name]
+		_, builtin := builtinFunctions[n.name]
+		constant = constant && builtin && !custom
+		folded = &CallNode{col: n.col, name: n.name, args: args}
+	case *UnaryNode:
+		operand := r.Fold(n.operand)
+		constant = isNumber(operand)
+		folded = &UnaryNode{col: n.col, op: n.op, operand: operand}
+	case *BinaryNode:
+		left, right := r.Fold(n.left), r.Fold(n.right)
+		constant = isNumber(left) && isNumber(right)
+		folded = &BinaryNode{col: n.col, op: n.op, left: left, right: right}
+	default:
+		return n
+	}
+
+	if !constant {
+		return folded
+	}
+	v, err := r.Eval(folded, nil)
+	if err != nil {
+		return folded
+	}
+	return &NumberNode{col: n.Pos(), text: strconv.FormatFloat(v, 'g', -1, 64), value: v}
+}
+
+func isNumber(n Node) bool {
+	_, ok := n.(*NumberNode)
+	return ok
+}
@@ -0,0 +1,262 @@
+package embed_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/seungkyua/go-test/interface/embed"
+)
+
+func TestParsePositions(t *testing.T) {
+	n, err := embed.Parse("rate = (used + 1.5) * max(x, 2)")
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+
+	assign, ok := n.(*embed.AssignNode)
+	if !ok || assign.Name() != "rate" || assign.Pos() != 1 {
+		t.Fatalf("unexpected root %#v", n)
+	}
+	mul, ok := assign.Value().(*embed.BinaryNode)
+	if !ok || mul.Op() != '*' || mul.Pos() != 21 {
+		t.Fatalf("unexpected value %#v", assign.Value())
+	}
+	add, ok := mul.Left().(*embed.BinaryNode)
+	if !ok || add.Op() != '+' || add.Pos() != 14 {
+		t.Fatalf("unexpected left %#v", mul.Left())
+	}
+	if v, ok := add.Left().(*embed.VariableNode); !ok || v.Name() != "used" || v.Pos() != 9 {
+		t.Errorf("unexpected variable %#v", add.Left())
+	}
+	if num, ok := add.Right().(*embed.NumberNode); !ok || num.Value() != 1.5 || num.Text() != "1.5" || num.Pos() != 16 {
+		t.Errorf("unexpected number %#v", add.Right())
+	}
+	call, ok := mul.Right().(*embed.CallNode)
+	if !ok || call.Name() != "max" || call.Pos() != 23 || len(call.Args()) != 2 {
+		t.Fatalf("unexpected call %#v", mul.Right())
+	}
+
+	// the arguments of a node are not shared
+	call.Args()[0] = nil
+	if call.Args()[0] == nil {
+		t.Error("Args returned the arguments of the node")
+	}
+
+	if _, err := embed.Parse("1 +"); err == nil || err.Error() != "unexpected end of expression at column 4" {
+		t.Errorf("unexpected error - %v", err)
+	}
+}
+
+func TestEval(t *testing.T) {
+	n, err := embed.Parse("used / total * 100")
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+
+	for _, test := range []struct {
+		vars embed.Vars
+		want float64
+		err  string
+	}{
+		{embed.Vars{"used": 1, "total": 4}, 25, ""},
+		{embed.Vars{"used": 3, "total": 4}, 75, ""},
+		{embed.Vars{"used": 3}, 0, `undefined variable "total" at column 8`},
+		{embed.Vars{"used": 3, "total": 0}, 0, "division by zero at column 6"},
+	} {
+		got, err := embed.Eval(n, test.vars)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Eval(%v): expected error %q, got %v", test.vars, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Eval(%v): unexpected error - %s", test.vars, err)
+		} else if got != test.want {
+			t.Errorf("Eval(%v): expected %g, got %g", test.vars, test.want, got)
+		}
+	}
+
+	// assignments bind the variable in the environment
+	vars := embed.Vars{"x": 2}
+	n, _ = embed.Parse("y = x ^ 3")
+	if v, err := embed.Eval(n, vars); err != nil || v != 8 || vars["y"] != 8 {
+		t.Errorf("unexpected assignment %g, %v, %v", v, vars, err)
+	}
+	if _, err := embed.Eval(n, nil); err == nil || err.Error() != `assignment to "y" needs a session at column 1` {
+		t.Errorf("unexpected error - %v", err)
+	}
+
+	// custom functions
+	r := embed.ArithmeticResolver{Functions: map[string]embed.Function{"cores": embed.Func1(func(m float64) float64 { return m / 1000 })}}
+	n, _ = embed.Parse("cores(x)")
+	if v, err := r.Eval(n, embed.Vars{"x": 1500}); err != nil || v != 1.5 {
+		t.Errorf("unexpected result %g, %v", v, err)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	for _, test := range []struct {
+		expression string
+		want       string
+	}{
+		{"1+2*3", "1 + 2 * 3"},
+		{"(1+2)*3", "(1 + 2) * 3"},
+		{"((x))", "x"},
+		{"1-(2-3)", "1 - (2 - 3)"},
+		{"(1-2)-3", "1 - 2 - 3"},
+		{"8/(4/2)", "8 / (4 / 2)"},
+		{"2^3^2", "2 ^ 3 ^ 2"},
+		{"(2^3)^2", "(2 ^ 3) ^ 2"},
+		{"-2^2", "-2 ^ 2"},
+		{"(-2)^2", "(-2) ^ 2"},
+		{"2^-x", "2 ^ -x"},
+		{"-(x+1)", "-(x + 1)"},
+		{"--x", "--x"},
+		{"2*-3", "2 * -3"},
+		{"1.50e3 % 7", "1500 % 7"},
+		{"max( 1,x ,  y)", "max(1, x, y)"},
+		{"y=(x)", "y = x"},
+	} {
+		n, err := embed.Parse(test.expression)
+		if err != nil {
+			t.Errorf("Parse(%q): unexpected error - %s", test.expression, err)
+			continue
+		}
+		got := embed.Format(n)
+		if got != test.want {
+			t.Errorf("Format(%q): expected %q, got %q", test.expression, test.want, got)
+		}
+
+		// the canonical form parses to the same tree
+		again, err := embed.Parse(got)
+		if err != nil {
+			t.Errorf("Parse(%q): unexpected error - %s", got, err)
+		} else if again.String() != got {
+			t.Errorf("Format(Parse(%q)): expected %q, got %q", got, got, again.String())
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	for _, test := range []struct {
+		expression string
+		want       string
+	}{
+		{"1 + 2 * 3", "7"},
+		{"x * (60 * 60)", "x * 3600"},
+		{"x * 60 * 60", "x * 60 * 60"},
+		{"max(1, 2 + 3) - x", "5 - x"},
+		{"-(1 - 3) ^ 2", "-4"},
+		{"0 - 2 + x", "-2 + x"},
+		{"x ^ (0 - 2)", "x ^ -2"},
+		{"(0 - 2) ^ x", "(-2) ^ x"},
+		{"y = 1 / 0 + x", "y = 1 / 0 + x"},
+		{"sqrt(-1) * 2", "sqrt(-1) * 2"},
+		{"max(x, 1 + 1)", "max(x, 2)"},
+		{"(0 * -1) ^ x", "(-0) ^ x"},
+	} {
+		n, err := embed.Parse(test.expression)
+		if err != nil {
+			t.Errorf("Parse(%q): unexpected error - %s", test.expression, err)
+			continue
+		}
+		before := n.String()
+		folded := embed.Fold(n)
+		if got := folded.String(); got != test.want {
+			t.Errorf("Fold(%q): expected %q, got %q", test.expression, test.want, got)
+		}
+		if folded.Pos() != n.Pos() {
+			t.Errorf("Fold(%q): expected position %d, got %d", test.expression, n.Pos(), folded.Pos())
+		}
+		if n.String() != before {
+			t.Errorf("Fold(%q) changed the parsed expression to %q", test.expression, n.String())
+		}
+
+		// folding does not change the result, nor does parsing the canonical form of the folded tree
+		vars := embed.Vars{"x": 3}
+		want, wantErr := embed.Eval(n, vars)
+		got, err := embed.Eval(folded, vars)
+		if !sameResult(got, err, want, wantErr) {
+			t.Errorf("Eval(Fold(%q)): expected %g, %v, got %g, %v", test.expression, want, wantErr, got, err)
+		}
+		reparsed, err := embed.Parse(folded.String())
+		if err != nil {
+			t.Errorf("Parse(%q): unexpected error - %s", folded, err)
+			continue
+		}
+		got, err = embed.Eval(reparsed, vars)
+		if !sameResult(got, err, want, wantErr) {
+			t.Errorf("Eval(Parse(%q)): expected %g, %v, got %g, %v", folded, want, wantErr, got, err)
+		}
+		if again := embed.Fold(reparsed).String(); again != folded.String() {
+			t.Errorf("Fold(Parse(%q)): expected %q, got %q", folded, folded, again)
+		}
+	}
+
+	// custom functions may not be pure, they are not folded
+	r := embed.ArithmeticResolver{Functions: map[string]embed.Function{"max": embed.Func2(math.Min)}}
+	n, _ := embed.Parse("max(1, 2) + 1 * 2")
+	if got := r.Fold(n).String(); got != "max(1, 2) + 2" {
+		t.Errorf("unexpected fold %q", got)
+	}
+}
+
+func sameResult(got float64, err error, want float64, wantErr error) bool {
+	if err != nil || wantErr != nil {
+		return err != nil && wantErr != nil && err.Error() == wantErr.Error()
+	}
+	return got == want || math.IsNaN(got) && math.IsNaN(want)
+}
+
+var benchmarkVars = []embed.Vars{
+	{"used": 1, "total": 4, "limit": 2},
+	{"used": 3, "total": 8, "limit": 5},
+	{"used": 7, "total": 9, "limit": 6},
+}
+
+const benchmarkExpression = "round(used / total * 100, 2) + max(used, limit) * (60 * 60) / 1000"
+
+func BenchmarkResolve(b *testing.B) {
+	sessions := make([]*embed.Session, len(benchmarkVars))
+	for i, vars := range benchmarkVars {
+		sessions[i] = embed.NewSession()
+		for name, value := range vars {
+			sessions[i].Set(name, value)
+		}
+	}
+	r := embed.ArithmeticResolver{}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.ResolveSession(sessions[i%len(sessions)], benchmarkExpression); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEval(b *testing.B) {
+	n, err := embed.Parse(benchmarkExpression)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := embed.Eval(n, benchmarkVars[i%len(benchmarkVars)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEvalFolded(b *testing.B) {
+	n, err := embed.Parse(benchmarkExpression)
+	if err != nil {
+		b.Fatal(err)
+	}
+	n = embed.Fold(n)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := embed.Eval(n, benchmarkVars[i%len(benchmarkVars)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package embed
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Result is the answer of one expression of a multi-line input.
+// Line is the 1-based line number in the input, Err is the error of this expression only.
+type Result struct {
+	Line       int
+	Expression string
+	Value      float64
+	Err        error
+}
+
+// ProcessAll resolves every line of r until EOF, skipping blank lines and lines starting with #.
+// With a Session, the lines are resolved in it in order.
+// The returned error is a read error of r, the results up to it are returned with it.
+func (c Calculator) ProcessAll(r io.Reader) ([]Result, error) {
+	return c.ProcessAllContext(context.Background(), r)
+}
+
+// ProcessAllContext is ProcessAll which stops when ctx is done, ctx.Err() is returned with the results so far
+func (c Calculator) ProcessAllContext(ctx context.Context, r io.Reader) ([]Result, error) {
+	var results []Result
+	_, err := c.processLines(ctx, r, func(result Result) bool {
+		results = append(results, result)
+		return true
+	})
+	return results, err
+}
+
+// ProcessStream is ProcessAll which sends each result on the returned channel as soon as its line is read.
+// The channel is closed at EOF or when ctx is done. A read error of r is sent as the last result,
+// with the number of the line which could not be read.
+func (c Calculator) ProcessStream(ctx context.Context, r io.Reader) <-chan Result {
+	results := make(chan Result)
+	go func() {
+		defer close(results)
+		send := func(result Result) bool {
+			select {
+			case results <- result:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		lines, err := c.processLines(ctx, r, send)
+		if err != nil && ctx.Err() == nil {
+			send(Result{Line: lines + 1, Err: err})
+		}
+	}()
+	return results
+}
+
+// processLines calls yield with the result of each expression of r until yield returns false or ctx is done.
+// It returns the number of lines read.
+func (c Calculator) processLines(ctx context.Context, r io.Reader, yield func(Result) bool) (int, error) {
+	if _, ok := r.(io.ByteReader); !ok {
+		r = bufio.NewReader(r)
+	}
+	for line := 1; ; line++ {
+		if err := ctx.Err(); err != nil {
+			return line - 1, err
+		}
+		text, err := readLine(r, c.MaxLineLength)
+		if err == io.EOF {
+			return line - 1, nil
+		}
+		if errors.Is(err, ErrLineTooLong) {
+			if !yield(Result{Line: line, Err: err}) {
+				return line, nil
+			}
+			continue
+		}
+		if err != nil {
+			return line - 1, err
+		}
+
+		expression := strings.TrimSpace(text)
+		if expression == "" || strings.HasPrefix(expression, "#") {
+			continue
+		}
+		value, err := c.resolve(ctx, expression)
+		if !yield(Result{Line: line, Expression: expression, Value: value, Err: err}) {
+			return line, nil
+		}
+	}
+}
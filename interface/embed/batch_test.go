@@ -0,0 +1,103 @@
+package embed_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/seungkyua/go-test/interface/embed"
+)
+
+const batchInput = `# capacity
+2 + 4 * 10
+
+( 2 + 4 ) * 10
+   # indented comment
+( 2 + 4 * 10
+1 / 0`
+
+func TestCalculatorProcessAll(t *testing.T) {
+	results, err := embed.Calculator{}.ProcessAll(strings.NewReader(batchInput))
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+
+	want := []struct {
+		line  int
+		value float64
+		err   string
+	}{
+		{2, 42, ""},
+		{4, 60, ""},
+		{6, 0, "unbalanced parenthesis at column 1"},
+		{7, 0, "division by zero at column 3"},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("want %d results got (%+v)", len(want), results)
+	}
+	for i, w := range want {
+		got := results[i]
+		if got.Line != w.line || got.Value != w.value || (got.Err == nil) != (w.err == "") ||
+			(got.Err != nil && got.Err.Error() != w.err) {
+			t.Errorf("want (%+v) got (%+v)", w, got)
+		}
+	}
+}
+
+func TestCalculatorProcessAllReadError(t *testing.T) {
+	readErr := errors.New("disk failure")
+	r := io.MultiReader(strings.NewReader("1 + 1\n2 + 2\n"), iotest.ErrReader(readErr))
+
+	results, err := embed.Calculator{}.ProcessAll(r)
+	if !errors.Is(err, readErr) {
+		t.Errorf("want (%v) got (%v)", readErr, err)
+	}
+	if len(results) != 2 || results[1].Value != 4 {
+		t.Errorf("want the results before the error got (%+v)", results)
+	}
+}
+
+func TestCalculatorProcessStream(t *testing.T) {
+	pr, pw := io.Pipe()
+	results := embed.Calculator{}.ProcessStream(context.Background(), pr)
+
+	// a result is sent before the next line is written
+	for i, line := range []string{"1 + 1\n", "# skip\n\n", "2 * 3\n"} {
+		if _, err := pw.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			continue
+		}
+		result := <-results
+		if result.Err != nil || result.Expression != strings.TrimSpace(line) {
+			t.Errorf("unexpected result (%+v)", result)
+		}
+	}
+	readErr := errors.New("connection reset")
+	_ = pw.CloseWithError(readErr)
+
+	result, ok := <-results
+	if !ok || !errors.Is(result.Err, readErr) || result.Line != 5 {
+		t.Errorf("want read error at line 5 got (%+v)", result)
+	}
+	if _, ok := <-results; ok {
+		t.Error("want closed channel")
+	}
+}
+
+func TestCalculatorProcessStreamCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	results := embed.Calculator{}.ProcessStream(ctx, strings.NewReader("1\n2\n3\n"))
+
+	if result := <-results; result.Value != 1 {
+		t.Errorf("want 1 got (%+v)", result)
+	}
+	cancel()
+	for range results {
+		// drains until the stream stops
+	}
+}
@@ -1,52 +1,67 @@
 package embed
 
 import (
+	"context"
 	"errors"
 	"io"
 )
 
+// Calculator resolves the expressions read from an io.Reader, one per line.
+// A nil Resolver is an ArithmeticResolver, a zero MaxLineLength is DefaultMaxLineLength.
+// With a Session, the expressions share its variables when the Resolver is a SessionResolver,
+// and each result is kept as _ for the next expression.
+// Middleware wraps the Resolver, the first one is the outermost.
 type Calculator struct {
-	Resolver MathResolver
+	Resolver      MathResolver
+	MaxLineLength int
+	Session       *Session
+	Middleware    []Middleware
 }
 
+// ErrNoExpression is returned by Process for an empty line or at the end of the input
+var ErrNoExpression = errors.New("no expression to read")
+
 type MathResolver interface {
 	Resolve(expression string) (float64, error)
 }
 
+// Process resolves the next line of r. It does not read past the line, so that successive calls
+// on the same reader resolve successive lines. Readers which are neither an io.ByteReader nor seekable
+// are read one byte at a time, wrap them in a bufio.Reader once to read them faster.
 func (c Calculator) Process(r io.Reader) (float64, error) {
-	expression, err := readOneLine(r)
+	return c.ProcessContext(context.Background(), r)
+}
+
+// ProcessContext is Process which stops resolving when ctx is done
+func (c Calculator) ProcessContext(ctx context.Context, r io.Reader) (float64, error) {
+	expression, err := readLine(r, c.MaxLineLength)
+	if err == io.EOF {
+		return 0, ErrNoExpression
+	}
 	if err != nil {
 		return 0, err
 	}
 	if len(expression) == 0 {
-		return 0, errors.New("no expression to read")
+		return 0, ErrNoExpression
 	}
-	answer, err := c.Resolver.Resolve(expression)
-	return answer, err
+	return c.resolve(ctx, expression)
 }
 
-func readOneLine(r io.Reader) (string, error) {
-	var out []byte
-	b := make([]byte, 1)
-	for {
-		_, err := r.Read(b)
-		if err != nil {
-			if err == io.EOF {
-				return string(out), nil
-			}
-		}
-		if b[0] == '\n' {
-			break
-		}
-		out = append(out, b[0])
+// resolve resolves one expression through the middleware, in the session of c when it has one
+func (c Calculator) resolve(ctx context.Context, expression string) (float64, error) {
+	resolver := c.Resolver
+	if resolver == nil {
+		resolver = ArithmeticResolver{}
+	}
+	if c.Session == nil {
+		return Chain(WithContext(resolver), c.Middleware...).ResolveContext(ctx, expression)
 	}
-	return string(out), nil
 
-	//scanner := bufio.NewScanner(r)
-	//for scanner.Scan() {
-	//	break
-	//}
-	//return scanner.Text()
+	answer, err := Chain(WithContext(resolver), c.Middleware...).ResolveContext(ContextWithSession(ctx, c.Session), expression)
+	if err == nil {
+		c.Session.setLast(answer)
+	}
+	return answer, err
 }
 
 //func main() {
@@ -43,3 +43,17 @@ func TestCalculatorProcess(t *testing.T) {
 		}
 	}
 }
+
+func TestCalculatorDefaultResolver(t *testing.T) {
+	c := embed.Calculator{}
+	in := strings.NewReader("2 + 4 * 10\n( 2 + 4 ) * 10\n( 2 + 4 * 10")
+
+	for _, want := range []float64{42, 60} {
+		if result, err := c.Process(in); err != nil || result != want {
+			t.Errorf("want (%f) got (%f, %v)", want, result, err)
+		}
+	}
+	if _, err := c.Process(in); err == nil || err.Error() != "unbalanced parenthesis at column 1" {
+		t.Errorf("want unbalanced parenthesis got (%v)", err)
+	}
+}
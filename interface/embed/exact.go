@@ -0,0 +1,513 @@
+package embed
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+)
+
+// DefaultPrecision is the mantissa precision in bits of inexact results when ExactResolver.Precision is not set
+const DefaultPrecision = 256
+
+// maxExactBits bounds the size of an exact power, larger powers are computed in float64
+const maxExactBits = 1 << 20
+
+// ExactResolver evaluates the expressions of ArithmeticResolver with exact rational arithmetic,
+// so that 0.1 + 0.2 is 0.3 and large integer sums do not lose precision.
+// Results which are not rational, such as sqrt(2), are big.Float values of Precision bits.
+// Fractional powers, log and the Functions are computed in float64 and their results are inexact.
+// It has no session, so expressions can not use variables.
+type ExactResolver struct {
+	// Precision is the mantissa precision in bits of inexact results (default DefaultPrecision)
+	Precision uint
+	// Functions are callable by name in addition to the built-in functions, they are called with float64 values
+	Functions map[string]Function
+}
+
+// Resolve implements MathResolver, the exact result is rounded to the nearest float64.
+// A result out of the float64 range is an error, as it is for ArithmeticResolver.
+func (r ExactResolver) Resolve(expression string) (float64, error) {
+	n, err := r.ResolveExact(expression)
+	if err != nil {
+		return 0, err
+	}
+	return float64Of(n)
+}
+
+// ResolveExact returns the exact result of expression
+func (r ExactResolver) ResolveExact(expression string) (*Number, error) {
+	root, err := parse(expression)
+	if err != nil {
+		return nil, err
+	}
+	prec := r.Precision
+	if prec == 0 {
+		prec = DefaultPrecision
+	}
+	return exactEvaluator{prec: prec, functions: r.Functions}.eval(root)
+}
+
+// Number is a result of ExactResolver: an exact rational or, when an operation is not rational,
+// a big.Float. Numbers are immutable.
+type Number struct {
+	rat   *big.Rat
+	float *big.Float
+}
+
+// NewNumber returns the exact number r
+func NewNumber(r *big.Rat) *Number {
+	return &Number{rat: new(big.Rat).Set(r)}
+}
+
+// IsExact reports whether the number is an exact rational
+func (n *Number) IsExact() bool {
+	return n.rat != nil
+}
+
+// Rat returns a copy of the exact value, nil when the number is inexact
+func (n *Number) Rat() *big.Rat {
+	if n.rat == nil {
+		return nil
+	}
+	return new(big.Rat).Set(n.rat)
+}
+
+// Float returns the number as a big.Float of prec bits
+func (n *Number) Float(prec uint) *big.Float {
+	if n.rat != nil {
+		return new(big.Float).SetPrec(prec).SetRat(n.rat)
+	}
+	return new(big.Float).SetPrec(prec).Set(n.float)
+}
+
+// Float64 returns the nearest float64
+func (n *Number) Float64() float64 {
+	if n.rat != nil {
+		f, _ := n.rat.Float64()
+		return f
+	}
+	f, _ := n.float.Float64()
+	return f
+}
+
+// String renders an exact number exactly: an integer, a decimal when it terminates such as 0.3,
+// and a fraction such as 1/3 otherwise. Inexact numbers are rendered with all their digits.
+func (n *Number) String() string {
+	if n.rat == nil {
+		return n.float.Text('g', -1)
+	}
+	if n.rat.IsInt() {
+		return n.rat.Num().String()
+	}
+	if digits, ok := decimalDigits(n.rat.Denom()); ok {
+		return n.rat.FloatString(digits)
+	}
+	return n.rat.String()
+}
+
+// FloatString renders the number as a decimal rounded to digits after the point
+func (n *Number) FloatString(digits int) string {
+	if n.rat == nil {
+		return n.float.Text('f', digits)
+	}
+	return n.rat.FloatString(digits)
+}
+
+// decimalDigits returns the number of decimals of 1/denom, ok is false when they do not terminate
+func decimalDigits(denom *big.Int) (int, bool) {
+	d := new(big.Int).Set(denom)
+	twos := 0
+	for d.Bit(0) == 0 {
+		d.Rsh(d, 1)
+		twos++
+	}
+	fives := 0
+	five, q, r := big.NewInt(5), new(big.Int), new(big.Int)
+	for {
+		q.QuoRem(d, five, r)
+		if r.Sign() != 0 {
+			break
+		}
+		d.Set(q)
+		fives++
+	}
+	if d.Cmp(big.NewInt(1)) != 0 {
+		return 0, false
+	}
+	return max(twos, fives), true
+}
+
+func ratNumber(r *big.Rat) *Number {
+	return &Number{rat: r}
+}
+
+func (n *Number) sign() int {
+	if n.rat != nil {
+		return n.rat.Sign()
+	}
+	return n.float.Sign()
+}
+
+// exactEvaluator evaluates nodes exactly
+type exactEvaluator struct {
+	prec      uint
+	functions map[string]Function
+}
+
+func (e exactEvaluator) eval(n Node) (*Number, error) {
+	switch n := n.(type) {
+	case *NumberNode:
+		r, ok := new(big.Rat).SetString(n.text)
+		if !ok {
+			return nil, syntaxErrorf(n.col, "invalid number %q", n.text)
+		}
+		return ratNumber(r), nil
+	case *VariableNode:
+		return nil, &EvalError{Column: n.col, Msg: fmt.Sprintf("undefined variable %q", n.name)}
+	case *AssignNode:
+		return nil, &EvalError{Column: n.col, Msg: fmt.Sprintf("assignment to %q needs a session", n.name)}
+	case *CallNode:
+		return e.call(n)
+	case *UnaryNode:
+		v, err := e.eval(n.operand)
+		if err != nil {
+			return nil, err
+		}
+		if n.op == '-' {
+			return e.neg(v), nil
+		}
+		return v, nil
+	case *BinaryNode:
+		left, err := e.eval(n.left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := e.eval(n.right)
+		if err != nil {
+			return nil, err
+		}
+		v, err := e.apply(n.op, left, right)
+		if err != nil {
+			return nil, &EvalError{Column: n.col, Msg: err.Error()}
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("unknown node %T", n)
+}
+
+func (e exactEvaluator) neg(v *Number) *Number {
+	if v.rat != nil {
+		return ratNumber(new(big.Rat).Neg(v.rat))
+	}
+	return &Number{float: new(big.Float).Neg(v.float)}
+}
+
+// apply is exact when both operands are exact, except for fractional powers
+func (e exactEvaluator) apply(op byte, left *Number, right *Number) (*Number, error) {
+	if op == '/' && right.sign() == 0 {
+		return nil, errors.New("division by zero")
+	}
+	if op == '%' && right.sign() == 0 {
+		return nil, errors.New("modulo by zero")
+	}
+	if op == '^' {
+		return e.pow(left, right)
+	}
+
+	if left.rat != nil && right.rat != nil {
+		x, y, r := left.rat, right.rat, new(big.Rat)
+		switch op {
+		case '+':
+			r.Add(x, y)
+		case '-':
+			r.Sub(x, y)
+		case '*':
+			r.Mul(x, y)
+		case '/':
+			r.Quo(x, y)
+		case '%':
+			// the remainder of a truncated division, as math.Mod
+			q := new(big.Rat).Quo(x, y)
+			r.Mul(y, new(big.Rat).SetInt(new(big.Int).Quo(q.Num(), q.Denom())))
+			r.Sub(x, r)
+		default:
+			return nil, fmt.Errorf("unknown operator %q", op)
+		}
+		return ratNumber(r), nil
+	}
+
+	x, y, f := left.Float(e.prec), right.Float(e.prec), new(big.Float).SetPrec(e.prec)
+	switch op {
+	case '+':
+		f.Add(x, y)
+	case '-':
+		f.Sub(x, y)
+	case '*':
+		f.Mul(x, y)
+	case '/':
+		f.Quo(x, y)
+	case '%':
+		trunc, _ := new(big.Float).SetPrec(e.prec).Quo(x, y).Int(nil)
+		f.Mul(y, new(big.Float).SetInt(trunc))
+		f.Sub(x, f)
+	default:
+		return nil, fmt.Errorf("unknown operator %q", op)
+	}
+	return &Number{float: f}, nil
+}
+
+// pow is exact for an exact base and an integer exponent, other powers are computed in float64
+func (e exactEvaluator) pow(base *Number, exponent *Number) (*Number, error) {
+	if base.rat != nil && exponent.rat != nil && exponent.rat.IsInt() && exponent.rat.Num().IsInt64() {
+		exp := exponent.rat.Num().Int64()
+		abs := exp
+		if abs < 0 {
+			abs = -abs
+		}
+		bits := int64(base.rat.Num().BitLen() + base.rat.Denom().BitLen())
+		if bits*abs <= maxExactBits {
+			if base.rat.Sign() == 0 && exp < 0 {
+				return nil, errors.New("division by zero")
+			}
+			n := big.NewInt(abs)
+			r := new(big.Rat).SetFrac(new(big.Int).Exp(base.rat.Num(), n, nil), new(big.Int).Exp(base.rat.Denom(), n, nil))
+			if exp < 0 {
+				r.Inv(r)
+			}
+			return ratNumber(r), nil
+		}
+	}
+	x, err := float64Of(base)
+	if err != nil {
+		return nil, err
+	}
+	y, err := float64Of(exponent)
+	if err != nil {
+		return nil, err
+	}
+	return e.float64Number(math.Pow(x, y), fmt.Sprintf("%g ^ %g", x, y))
+}
+
+// float64Of returns the nearest float64 of n, an error when n is out of the float64 range
+func float64Of(n *Number) (float64, error) {
+	v := n.Float64()
+	if math.IsInf(v, 0) {
+		return 0, fmt.Errorf("%s is out of the float64 range", n.Float(64).Text('g', 6))
+	}
+	return v, nil
+}
+
+// float64Number is an inexact result computed in float64 by operation
+func (e exactEvaluator) float64Number(v float64, operation string) (*Number, error) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil, fmt.Errorf("%s is not a finite number", operation)
+	}
+	return &Number{float: new(big.Float).SetPrec(e.prec).SetFloat64(v)}, nil
+}
+
+func (e exactEvaluator) call(n *CallNode) (*Number, error) {
+	f, ok := function(e.functions, n.name)
+	if !ok {
+		return nil, &EvalError{Column: n.col, Msg: fmt.Sprintf("unknown function %q", n.name)}
+	}
+	if err := f.check(n.name, len(n.args)); err != nil {
+		return nil, &EvalError{Column: n.col, Msg: err.Error()}
+	}
+
+	args := make([]*Number, len(n.args))
+	for i, arg := range n.args {
+		v, err := e.eval(arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	exactCall, ok := exactFunctions[n.name]
+	if _, custom := e.functions[n.name]; ok && !custom {
+		v, err := exactCall(e, args)
+		if err != nil {
+			return nil, &EvalError{Column: n.col, Msg: fmt.Sprintf("%s: %s", n.name, err)}
+		}
+		return v, nil
+	}
+
+	values := make([]float64, len(args))
+	for i, arg := range args {
+		v, err := float64Of(arg)
+		if err != nil {
+			return nil, &EvalError{Column: n.col, Msg: fmt.Sprintf("%s: %s", n.name, err)}
+		}
+		values[i] = v
+	}
+	v, err := f.Call(values...)
+	if err != nil {
+		return nil, &EvalError{Column: n.col, Msg: fmt.Sprintf("%s: %s", n.name, err)}
+	}
+	result, err := e.float64Number(v, n.name+formatArgs(values))
+	if err != nil {
+		return nil, &EvalError{Column: n.col, Msg: err.Error()}
+	}
+	return result, nil
+}
+
+// exactFunctions are the built-in functions which keep exact arguments exact,
+// the others are called with float64 values
+var exactFunctions = map[string]func(e exactEvaluator, args []*Number) (*Number, error){
+	"min": func(e exactEvaluator, args []*Number) (*Number, error) {
+		return e.extreme(args, -1), nil
+	},
+	"max": func(e exactEvaluator, args []*Number) (*Number, error) {
+		return e.extreme(args, 1), nil
+	},
+	"abs": func(e exactEvaluator, args []*Number) (*Number, error) {
+		if args[0].sign() < 0 {
+			return e.neg(args[0]), nil
+		}
+		return args[0], nil
+	},
+	"ceil": func(e exactEvaluator, args []*Number) (*Number, error) {
+		return e.integer(args[0], true), nil
+	},
+	"floor": func(e exactEvaluator, args []*Number) (*Number, error) {
+		return e.integer(args[0], false), nil
+	},
+	"round": func(e exactEvaluator, args []*Number) (*Number, error) {
+		digits := int64(0)
+		if len(args) == 2 {
+			d := args[1].rat
+			if d == nil || !d.IsInt() || !d.Num().IsInt64() || d.Num().CmpAbs(big.NewInt(1000)) > 0 {
+				return nil, errors.New("digits must be an integer")
+			}
+			digits = d.Num().Int64()
+		}
+		return e.round(args[0], digits), nil
+	},
+	"sqrt": func(e exactEvaluator, args []*Number) (*Number, error) {
+		if args[0].sign() < 0 {
+			return nil, errors.New("square root of a negative number")
+		}
+		if r := args[0].rat; r != nil {
+			num, denom := new(big.Int).Sqrt(r.Num()), new(big.Int).Sqrt(r.Denom())
+			if new(big.Int).Mul(num, num).Cmp(r.Num()) == 0 && new(big.Int).Mul(denom, denom).Cmp(r.Denom()) == 0 {
+				return ratNumber(new(big.Rat).SetFrac(num, denom)), nil
+			}
+		}
+		return &Number{float: new(big.Float).SetPrec(e.prec).Sqrt(args[0].Float(e.prec))}, nil
+	},
+	"pow": func(e exactEvaluator, args []*Number) (*Number, error) {
+		return e.pow(args[0], args[1])
+	},
+	"median": func(e exactEvaluator, args []*Number) (*Number, error) {
+		return e.percentile(ratNumber(big.NewRat(50, 1)), args)
+	},
+	"percentile": func(e exactEvaluator, args []*Number) (*Number, error) {
+		return e.percentile(args[0], args[1:])
+	},
+}
+
+func (e exactEvaluator) compare(a *Number, b *Number) int {
+	if a.rat != nil && b.rat != nil {
+		return a.rat.Cmp(b.rat)
+	}
+	return a.Float(e.prec).Cmp(b.Float(e.prec))
+}
+
+// extreme returns the smallest argument for a negative direction and the largest for a positive one
+func (e exactEvaluator) extreme(args []*Number, direction int) *Number {
+	v := args[0]
+	for _, arg := range args[1:] {
+		if e.compare(arg, v)*direction > 0 {
+			v = arg
+		}
+	}
+	return v
+}
+
+// integer returns the ceiling or the floor of v, the integer of an inexact number is exact
+func (e exactEvaluator) integer(v *Number, ceil bool) *Number {
+	var i *big.Int
+	exact := true
+	if v.rat != nil {
+		i = new(big.Int).Quo(v.rat.Num(), v.rat.Denom())
+		exact = v.rat.IsInt()
+	} else {
+		var acc big.Accuracy
+		i, acc = v.float.Int(nil)
+		exact = acc == big.Exact
+	}
+	// i is truncated toward zero
+	if !exact && ceil && v.sign() > 0 {
+		i.Add(i, big.NewInt(1))
+	}
+	if !exact && !ceil && v.sign() < 0 {
+		i.Sub(i, big.NewInt(1))
+	}
+	return ratNumber(new(big.Rat).SetInt(i))
+}
+
+// round rounds v half away from zero to digits decimals
+func (e exactEvaluator) round(v *Number, digits int64) *Number {
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(abs64(digits)), nil))
+	if digits < 0 {
+		scale.Inv(scale)
+	}
+	half := big.NewRat(1, 2)
+	if v.sign() < 0 {
+		half.Neg(half)
+	}
+
+	if v.rat != nil {
+		scaled := new(big.Rat).Mul(v.rat, scale)
+		scaled.Add(scaled, half)
+		rounded := new(big.Rat).SetInt(new(big.Int).Quo(scaled.Num(), scaled.Denom()))
+		return ratNumber(rounded.Quo(rounded, scale))
+	}
+	s := new(big.Float).SetPrec(e.prec).SetRat(scale)
+	scaled := new(big.Float).SetPrec(e.prec).Mul(v.float, s)
+	scaled.Add(scaled, new(big.Float).SetRat(half))
+	i, _ := scaled.Int(nil)
+	f := new(big.Float).SetPrec(e.prec).SetInt(i)
+	return &Number{float: f.Quo(f, s)}
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// percentile interpolates between the closest ranks as the float64 percentile
+func (e exactEvaluator) percentile(p *Number, values []*Number) (*Number, error) {
+	if p.sign() < 0 || e.compare(p, ratNumber(big.NewRat(100, 1))) > 0 {
+		return nil, fmt.Errorf("percentile %s is not between 0 and 100", p)
+	}
+	sorted := append([]*Number(nil), values...)
+	sort.SliceStable(sorted, func(i, j int) bool { return e.compare(sorted[i], sorted[j]) < 0 })
+
+	// rank = p / 100 * (n - 1)
+	rank, err := e.apply('*', p, ratNumber(big.NewRat(int64(len(sorted)-1), 100)))
+	if err != nil {
+		return nil, err
+	}
+	lower := e.integer(rank, false).rat.Num().Int64()
+	if lower == int64(len(sorted)-1) {
+		return sorted[lower], nil
+	}
+	frac, err := e.apply('-', rank, ratNumber(big.NewRat(lower, 1)))
+	if err != nil {
+		return nil, err
+	}
+	diff, err := e.apply('-', sorted[lower+1], sorted[lower])
+	if err != nil {
+		return nil, err
+	}
+	step, err := e.apply('*', diff, frac)
+	if err != nil {
+		return nil, err
+	}
+	return e.apply('+', sorted[lower], step)
+}
@@ -0,0 +1,161 @@
+package embed_test
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/seungkyua/go-test/interface/embed"
+)
+
+func TestExactResolver(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       string
+		exact      bool
+	}{
+		{"0.1 + 0.2", "0.3", true},
+		{"9007199254740993 + 1", "9007199254740994", true},
+		{"99999999999999999999 * 99999999999999999999", "9999999999999999999800000000000000000001", true},
+		{"1 / 3", "1/3", true},
+		{"1 / 3 * 3", "1", true},
+		{"1 / 8", "0.125", true},
+		{"2 ^ 100", "1267650600228229401496703205376", true},
+		{"2 ^ -2", "0.25", true},
+		{"(2/3) ^ 2", "4/9", true},
+		{"-7 % 4", "-3", true},
+		{"7.5 % 2", "1.5", true},
+		{"1.5e3 / 1E-1", "15000", true},
+		{"min(0.3, 0.1 + 0.2, 1)", "0.3", true},
+		{"max(1/3, 0.3)", "1/3", true},
+		{"abs(-0.1)", "0.1", true},
+		{"round(2.5)", "3", true},
+		{"round(-2.5)", "-3", true},
+		{"round(1/3, 4)", "0.3333", true},
+		{"round(1250, -2)", "1300", true},
+		{"ceil(-1.5) + floor(-1.5)", "-3", true},
+		{"ceil(1/3)", "1", true},
+		{"sqrt(16/9)", "4/3", true},
+		{"pow(10, 20)", "100000000000000000000", true},
+		{"median(1, 2, 3, 4)", "2.5", true},
+		{"percentile(90, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10)", "9.1", true},
+		{"floor(sqrt(2) * 1000)", "1414", true},
+	}
+	for _, tt := range tests {
+		got, err := embed.ExactResolver{}.ResolveExact(tt.expression)
+		if err != nil {
+			t.Errorf("%s: unexpected error - %s", tt.expression, err)
+			continue
+		}
+		if got.String() != tt.want || got.IsExact() != tt.exact {
+			t.Errorf("%s: want (%s, exact %t) got (%s, exact %t)", tt.expression, tt.want, tt.exact, got, got.IsExact())
+		}
+	}
+}
+
+func TestExactResolverInexact(t *testing.T) {
+	got, err := embed.ExactResolver{Precision: 100}.ResolveExact("sqrt(2)")
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if got.IsExact() || got.Rat() != nil || got.Float(100).Prec() != 100 {
+		t.Errorf("want an inexact number of 100 bits got (%s)", got)
+	}
+	if s := got.FloatString(20); s != "1.41421356237309504880" {
+		t.Errorf("want 20 digits of sqrt(2) got (%s)", s)
+	}
+
+	// more precision gives more digits
+	high, _ := embed.ExactResolver{Precision: 512}.ResolveExact("sqrt(2)")
+	if len(high.String()) <= len(got.String()) {
+		t.Errorf("want more digits with more precision got (%s) and (%s)", high, got)
+	}
+
+	for _, expression := range []string{"2 ^ 0.5", "log(100, 10)", "sqrt(2) + 1"} {
+		if v, err := (embed.ExactResolver{}).ResolveExact(expression); err != nil || v.IsExact() {
+			t.Errorf("%s: want inexact got (%v, %v)", expression, v, err)
+		}
+	}
+}
+
+func TestExactResolverErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"1 / (0.1 - 0.1)", "division by zero at column 3"},
+		{"1 % 0", "modulo by zero at column 3"},
+		{"0 ^ -1", "division by zero at column 3"},
+		{"(-8) ^ 0.5", "-8 ^ 0.5 is not a finite number at column 6"},
+		{"sqrt(-1)", "sqrt: square root of a negative number at column 1"},
+		{"round(1, 0.5)", "round: digits must be an integer at column 1"},
+		{"x + 1", `undefined variable "x" at column 1`},
+		{"( 2 + 4 * 10", "unbalanced parenthesis at column 1"},
+	}
+	for _, tt := range tests {
+		_, err := embed.ExactResolver{}.ResolveExact(tt.expression)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: want (%s) got (%v)", tt.expression, tt.want, err)
+		}
+	}
+}
+
+func TestExactResolverOutOfRange(t *testing.T) {
+	// the exact result is fine, its float64 is not
+	if n, err := (embed.ExactResolver{}).ResolveExact("10 ^ 400"); err != nil || !n.IsExact() {
+		t.Errorf("want an exact result got (%v, %v)", n, err)
+	}
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"10 ^ 400", "1e+400 is out of the float64 range"},
+		{"-(10 ^ 400)", "-1e+400 is out of the float64 range"},
+		{"2 ^ -(10 ^ 400)", "-1e+400 is out of the float64 range at column 3"},
+		{"(10 ^ 400) ^ 0.5", "1e+400 is out of the float64 range at column 12"},
+		{"cores(10 ^ 400)", "cores: 1e+400 is out of the float64 range at column 1"},
+	}
+	r := embed.ExactResolver{Functions: map[string]embed.Function{
+		"cores": embed.Func1(func(m float64) float64 { return m / 1000 }),
+	}}
+	for _, tt := range tests {
+		_, err := r.Resolve(tt.expression)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: want (%s) got (%v)", tt.expression, tt.want, err)
+		}
+	}
+	if _, err := (embed.ArithmeticResolver{}).Resolve("10 ^ 400"); err == nil {
+		t.Error("want the arithmetic resolver to fail as well")
+	}
+}
+
+func TestExactResolverCalculator(t *testing.T) {
+	// the float64 Calculator API works with the exact resolver
+	c := embed.Calculator{Resolver: embed.ExactResolver{}}
+	results, err := c.ProcessAll(strings.NewReader("0.1 + 0.2\n1 / 3\n"))
+	if err != nil || len(results) != 2 || results[0].Value != 0.3 || results[1].Value != 1.0/3 {
+		t.Errorf("unexpected results (%+v, %v)", results, err)
+	}
+}
+
+func TestExactResolverFunctions(t *testing.T) {
+	r := embed.ExactResolver{Functions: map[string]embed.Function{
+		"cores": embed.Func1(func(m float64) float64 { return m / 1000 }),
+	}}
+	got, err := r.ResolveExact("cores(2500)")
+	if err != nil || got.IsExact() || got.Float64() != 2.5 {
+		t.Errorf("want inexact 2.5 got (%v, %v)", got, err)
+	}
+}
+
+func TestNumber(t *testing.T) {
+	n := embed.NewNumber(big.NewRat(2, 3))
+	if !n.IsExact() || n.String() != "2/3" || n.FloatString(3) != "0.667" {
+		t.Errorf("unexpected number (%s, %s)", n, n.FloatString(3))
+	}
+	r := n.Rat()
+	r.SetInt64(5)
+	if n.String() != "2/3" {
+		t.Errorf("want an immutable number got (%s)", n)
+	}
+}
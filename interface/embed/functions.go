@@ -0,0 +1,146 @@
+package embed
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Function is a Go function callable from expressions by name
+type Function struct {
+	// MinArgs and MaxArgs bound the number of arguments, a negative MaxArgs takes any number from MinArgs
+	MinArgs int
+	MaxArgs int
+	Call    func(args ...float64) (float64, error)
+}
+
+// Func1 is a Function of one argument, such as cores(millicores)
+func Func1(fn func(x float64) float64) Function {
+	return Function{MinArgs: 1, MaxArgs: 1, Call: func(args ...float64) (float64, error) {
+		return fn(args[0]), nil
+	}}
+}
+
+// Func2 is a Function of two arguments
+func Func2(fn func(x float64, y float64) float64) Function {
+	return Function{MinArgs: 2, MaxArgs: 2, Call: func(args ...float64) (float64, error) {
+		return fn(args[0], args[1]), nil
+	}}
+}
+
+// check returns an error when the function has no implementation or a call has a number of arguments
+// the function does not take
+func (f Function) check(name string, n int) error {
+	switch {
+	case f.Call == nil:
+		return fmt.Errorf("function %q has no implementation", name)
+	case f.MinArgs == f.MaxArgs && n != f.MinArgs:
+		return fmt.Errorf("%s expects %s, got %d", name, plural(f.MinArgs, "argument"), n)
+	case f.MaxArgs < 0 && n < f.MinArgs:
+		return fmt.Errorf("%s expects at least %s, got %d", name, plural(f.MinArgs, "argument"), n)
+	case f.MaxArgs >= 0 && (n < f.MinArgs || n > f.MaxArgs):
+		return fmt.Errorf("%s expects %d to %d arguments, got %d", name, f.MinArgs, f.MaxArgs, n)
+	}
+	return nil
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+var builtinFunctions = map[string]Function{
+	"min":   {MinArgs: 1, MaxArgs: -1, Call: minOf},
+	"max":   {MinArgs: 1, MaxArgs: -1, Call: maxOf},
+	"abs":   Func1(math.Abs),
+	"round": {MinArgs: 1, MaxArgs: 2, Call: round},
+	"ceil":  Func1(math.Ceil),
+	"floor": Func1(math.Floor),
+	"sqrt":  Func1(math.Sqrt),
+	"log":   {MinArgs: 1, MaxArgs: 2, Call: logOf},
+	"pow":   Func2(math.Pow),
+
+	"median":     {MinArgs: 1, MaxArgs: -1, Call: func(args ...float64) (float64, error) { return percentile(50, args) }},
+	"percentile": {MinArgs: 2, MaxArgs: -1, Call: func(args ...float64) (float64, error) { return percentile(args[0], args[1:]) }},
+}
+
+// BuiltinFunctions returns the names of the built-in functions:
+//
+//	min(x, ...), max(x, ...)   the smallest and the largest argument
+//	abs(x), ceil(x), floor(x)  as the math package
+//	round(x [, digits])        x rounded half away from zero to digits decimals
+//	sqrt(x), pow(x, y)         as the math package
+//	log(x [, base])            the natural logarithm, or the logarithm in base
+//	median(x, ...)             the 50th percentile
+//	percentile(p, x, ...)      the p-th percentile (0-100) of the values, interpolated between the closest ranks
+func BuiltinFunctions() []string {
+	names := make([]string, 0, len(builtinFunctions))
+	for name := range builtinFunctions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func minOf(args ...float64) (float64, error) {
+	v := args[0]
+	for _, arg := range args[1:] {
+		v = math.Min(v, arg)
+	}
+	return v, nil
+}
+
+func maxOf(args ...float64) (float64, error) {
+	v := args[0]
+	for _, arg := range args[1:] {
+		v = math.Max(v, arg)
+	}
+	return v, nil
+}
+
+func round(args ...float64) (float64, error) {
+	if len(args) == 1 {
+		return math.Round(args[0]), nil
+	}
+	if args[1] != math.Trunc(args[1]) {
+		return 0, errors.New("digits must be an integer")
+	}
+	scale := math.Pow(10, args[1])
+	return math.Round(args[0]*scale) / scale, nil
+}
+
+func logOf(args ...float64) (float64, error) {
+	if len(args) == 1 {
+		return math.Log(args[0]), nil
+	}
+	if args[1] <= 0 || args[1] == 1 {
+		return 0, fmt.Errorf("invalid base %g", args[1])
+	}
+	return math.Log(args[0]) / math.Log(args[1]), nil
+}
+
+func percentile(p float64, values []float64) (float64, error) {
+	if math.IsNaN(p) || p < 0 || p > 100 {
+		return 0, fmt.Errorf("percentile %g is not between 0 and 100", p)
+	}
+	if len(values) == 0 {
+		return 0, errors.New("no values")
+	}
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return 0, fmt.Errorf("value %g is not a finite number", v)
+		}
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	if lower == len(sorted)-1 {
+		return sorted[lower], nil
+	}
+	return sorted[lower] + (sorted[lower+1]-sorted[lower])*(rank-float64(lower)), nil
+}
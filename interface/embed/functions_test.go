@@ -0,0 +1,147 @@
+package embed_test
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/seungkyua/go-test/interface/embed"
+)
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       float64
+	}{
+		{"min(3, 1, 2)", 1},
+		{"max(3, -1, 2) * 2", 6},
+		{"abs(-2.5)", 2.5},
+		{"round(2.5)", 3},
+		{"round(-2.5)", -3},
+		{"round(3.14159, 2)", 3.14},
+		{"ceil(1.2) + floor(1.8)", 3},
+		{"sqrt(16)", 4},
+		{"log(1)", 0},
+		{"log(1000, 10)", 3},
+		{"pow(2, 10)", 1024},
+		{"median(5, 1, 3)", 3},
+		{"median(4, 1, 3, 2)", 2.5},
+		{"percentile(90, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10)", 9.1},
+		{"percentile(100, 3, 1, 2)", 3},
+		{"percentile(0, 3, 1, 2)", 1},
+		{"max(min(4, 8), 2) ^ 2", 16},
+		{"-abs(-1)", -1},
+	}
+	for _, tt := range tests {
+		got, err := embed.ArithmeticResolver{}.Resolve(tt.expression)
+		if err != nil || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: want (%g) got (%g, %v)", tt.expression, tt.want, got, err)
+		}
+	}
+}
+
+func TestFunctionErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"sqrt(1, 2)", "sqrt expects 1 argument, got 2 at column 1"},
+		{"1 + pow(2)", "pow expects 2 arguments, got 1 at column 5"},
+		{"min()", "min expects at least 1 argument, got 0 at column 1"},
+		{"round(1, 2, 3)", "round expects 1 to 2 arguments, got 3 at column 1"},
+		{"cores(2)", `unknown function "cores" at column 1`},
+		{"sqrt(-1)", "sqrt(-1) is not a finite number at column 1"},
+		{"percentile(101, 1)", "percentile: percentile 101 is not between 0 and 100 at column 1"},
+		{"log(8, 1)", "log: invalid base 1 at column 1"},
+		{"round(1, 0.5)", "round: digits must be an integer at column 1"},
+		{"max(1, 2", "unbalanced parenthesis at column 4"},
+		{"max(1 2)", `unexpected "2" at column 7`},
+		{"max(1,)", `unexpected ")" at column 7`},
+	}
+	for _, tt := range tests {
+		_, err := embed.ArithmeticResolver{}.Resolve(tt.expression)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: want (%s) got (%v)", tt.expression, tt.want, err)
+		}
+	}
+
+	// a registered function without Call is an error rather than a panic
+	functions := map[string]embed.Function{"cores": {MinArgs: 1, MaxArgs: 1}}
+	want := `function "cores" has no implementation at column 3`
+	for _, r := range []embed.MathResolver{embed.ArithmeticResolver{Functions: functions}, embed.ExactResolver{Functions: functions}} {
+		if _, err := r.Resolve("1+cores(2)"); err == nil || err.Error() != want {
+			t.Errorf("%T: want (%s) got (%v)", r, want, err)
+		}
+	}
+}
+
+func TestPercentileNotFinite(t *testing.T) {
+	n, err := embed.Parse("percentile(p, x, 2)")
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	tests := []struct {
+		vars embed.Vars
+		want string
+	}{
+		{embed.Vars{"p": math.NaN(), "x": 1}, "percentile: percentile NaN is not between 0 and 100 at column 1"},
+		{embed.Vars{"p": math.Inf(1), "x": 1}, "percentile: percentile +Inf is not between 0 and 100 at column 1"},
+		{embed.Vars{"p": 50, "x": math.NaN()}, "percentile: value NaN is not a finite number at column 1"},
+		{embed.Vars{"p": 50, "x": math.Inf(-1)}, "percentile: value -Inf is not a finite number at column 1"},
+	}
+	for _, tt := range tests {
+		if _, err := embed.Eval(n, tt.vars); err == nil || err.Error() != tt.want {
+			t.Errorf("%v: want (%s) got (%v)", tt.vars, tt.want, err)
+		}
+	}
+	n, _ = embed.Parse("median(x, 1)")
+	if _, err := embed.Eval(n, embed.Vars{"x": math.NaN()}); err == nil || err.Error() != "median: value NaN is not a finite number at column 1" {
+		t.Errorf("median: want error got (%v)", err)
+	}
+}
+
+func TestRegisteredFunctions(t *testing.T) {
+	r := embed.ArithmeticResolver{Functions: map[string]embed.Function{
+		"cores": embed.Func1(func(millicores float64) float64 { return millicores / 1000 }),
+		"ratio": {MinArgs: 2, MaxArgs: 2, Call: func(args ...float64) (float64, error) {
+			if args[1] == 0 {
+				return 0, errors.New("empty total")
+			}
+			return args[0] / args[1] * 100, nil
+		}},
+		// overrides the built-in
+		"abs": embed.Func1(func(x float64) float64 { return 42 }),
+	}}
+
+	for expression, want := range map[string]float64{
+		"cores(2500) * 2":    5,
+		"ratio(1, 4)":        25,
+		"abs(-1)":            42,
+		"min(cores(500), 1)": 0.5,
+	} {
+		if got, err := r.Resolve(expression); err != nil || got != want {
+			t.Errorf("%s: want (%g) got (%g, %v)", expression, want, got, err)
+		}
+	}
+	if _, err := r.Resolve("ratio(1, 0)"); err == nil || err.Error() != "ratio: empty total at column 1" {
+		t.Errorf("want function error got (%v)", err)
+	}
+	if _, err := r.Resolve("cores()"); err == nil || err.Error() != "cores expects 1 argument, got 0 at column 1" {
+		t.Errorf("want arity error got (%v)", err)
+	}
+
+	// a variable may have the name of a function
+	c := embed.Calculator{Resolver: r, Session: embed.NewSession()}
+	results, err := c.ProcessAll(strings.NewReader("min = 3\nmin(min, 5)"))
+	if err != nil || len(results) != 2 || results[1].Value != 3 {
+		t.Errorf("unexpected results (%+v, %v)", results, err)
+	}
+}
+
+func TestBuiltinFunctionNames(t *testing.T) {
+	names := embed.BuiltinFunctions()
+	if len(names) != 11 || names[0] != "abs" {
+		t.Errorf("unexpected built-in functions (%v)", names)
+	}
+}
@@ -0,0 +1,117 @@
+package embed
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+	tokenIdentifier
+	tokenAssign
+	tokenComma
+)
+
+// token is a lexeme of an expression, col is its 1-based column
+type token struct {
+	kind tokenKind
+	text string
+	col  int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+// SyntaxError is an invalid expression, Column is 1-based
+type SyntaxError struct {
+	Column int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at column %d", e.Msg, e.Column)
+}
+
+func syntaxErrorf(col int, format string, args ...interface{}) *SyntaxError {
+	return &SyntaxError{Column: col, Msg: fmt.Sprintf(format, args...)}
+}
+
+// tokenize splits an expression into tokens, the last one is tokenEOF
+func tokenize(expression string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expression); {
+		ch := expression[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n':
+			i++
+		case isDigit(ch) || ch == '.':
+			end := scanNumber(expression, i)
+			tokens = append(tokens, token{kind: tokenNumber, text: expression[i:end], col: i + 1})
+			i = end
+		case isLetter(ch):
+			end := i + 1
+			for end < len(expression) && (isLetter(expression[end]) || isDigit(expression[end])) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdentifier, text: expression[i:end], col: i + 1})
+			i = end
+		case ch == '=':
+			tokens = append(tokens, token{kind: tokenAssign, text: "=", col: i + 1})
+			i++
+		case ch == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", col: i + 1})
+			i++
+		case ch == '(':
+			tokens = append(tokens, token{kind: tokenLeftParen, text: "(", col: i + 1})
+			i++
+		case ch == ')':
+			tokens = append(tokens, token{kind: tokenRightParen, text: ")", col: i + 1})
+			i++
+		case ch == '+' || ch == '-' || ch == '*' || ch == '/' || ch == '%' || ch == '^':
+			tokens = append(tokens, token{kind: tokenOperator, text: string(ch), col: i + 1})
+			i++
+		default:
+			return nil, syntaxErrorf(i+1, "unexpected character %q", rune(ch))
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, col: len(expression) + 1}), nil
+}
+
+// scanNumber returns the end of the number starting at i: digits, a fraction and an exponent.
+// Malformed numbers such as 1.2.3 are scanned whole and rejected by the parser.
+func scanNumber(s string, i int) int {
+	for i < len(s) && (isDigit(s[i]) || s[i] == '.') {
+		i++
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j := i + 1
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		if j < len(s) && isDigit(s[j]) {
+			for j < len(s) && isDigit(s[j]) {
+				j++
+			}
+			return j
+		}
+	}
+	return i
+}
+
+func isLetter(ch byte) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+}
+
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
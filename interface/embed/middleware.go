@@ -0,0 +1,210 @@
+package embed
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ContextResolver is a resolver which stops when its context is done, such as a remote resolver
+type ContextResolver interface {
+	ResolveContext(ctx context.Context, expression string) (float64, error)
+}
+
+// ResolverFunc is a function used as a ContextResolver
+type ResolverFunc func(ctx context.Context, expression string) (float64, error)
+
+func (f ResolverFunc) ResolveContext(ctx context.Context, expression string) (float64, error) {
+	return f(ctx, expression)
+}
+
+// WithContext adapts a MathResolver to a ContextResolver, a ContextResolver is returned as is.
+// The MathResolver is not called when the context is already done, and a SessionResolver
+// resolves in the session of the context.
+func WithContext(r MathResolver) ContextResolver {
+	if cr, ok := r.(ContextResolver); ok {
+		return cr
+	}
+	return ResolverFunc(func(ctx context.Context, expression string) (float64, error) {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		if sr, ok := r.(SessionResolver); ok {
+			if s := SessionFromContext(ctx); s != nil {
+				return sr.ResolveSession(s, expression)
+			}
+		}
+		return r.Resolve(expression)
+	})
+}
+
+type sessionKey struct{}
+
+// ContextWithSession returns a context which carries the session s to the resolvers
+func ContextWithSession(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+// SessionFromContext returns the session of ctx, nil when it has none
+func SessionFromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(sessionKey{}).(*Session)
+	return s
+}
+
+// Middleware wraps a resolver with a behavior, such as caching
+type Middleware func(next ContextResolver) ContextResolver
+
+// Chain wraps r with middleware, the first middleware is the outermost
+func Chain(r ContextResolver, middleware ...Middleware) ContextResolver {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		r = middleware[i](r)
+	}
+	return r
+}
+
+// Cache keeps the results of up to size expressions, the least recently used is evicted.
+// Errors are not cached, and expressions resolved in a session are not cached since they may depend on it.
+// The cache is shared by every resolver the returned middleware wraps.
+// The results never expire, so Cache only suits pure resolvers such as ArithmeticResolver,
+// use CacheTTL for a resolver of data which changes, such as metrics.
+func Cache(size int) Middleware {
+	return CacheTTL(size, 0)
+}
+
+// CacheTTL is Cache whose results expire ttl after they are resolved, a ttl of 0 never expires
+func CacheTTL(size int, ttl time.Duration) Middleware {
+	if size <= 0 {
+		size = 1000
+	}
+	c := &resultCache{size: size, ttl: ttl, lru: list.New(), entries: make(map[string]*list.Element)}
+	return func(next ContextResolver) ContextResolver {
+		return ResolverFunc(func(ctx context.Context, expression string) (float64, error) {
+			if SessionFromContext(ctx) != nil {
+				return next.ResolveContext(ctx, expression)
+			}
+			if v, ok := c.get(expression); ok {
+				return v, nil
+			}
+			v, err := next.ResolveContext(ctx, expression)
+			if err == nil {
+				c.add(expression, v)
+			}
+			return v, err
+		})
+	}
+}
+
+type resultCache struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type cachedResult struct {
+	expression string
+	value      float64
+	// expires is zero when the result does not expire
+	expires time.Time
+}
+
+func (c *resultCache) get(expression string) (float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[expression]
+	if !ok {
+		return 0, false
+	}
+	result := el.Value.(*cachedResult)
+	if !result.expires.IsZero() && !time.Now().Before(result.expires) {
+		c.lru.Remove(el)
+		delete(c.entries, expression)
+		return 0, false
+	}
+	c.lru.MoveToFront(el)
+	return result.value, true
+}
+
+func (c *resultCache) add(expression string, value float64) {
+	var expires time.Time
+	if c.ttl > 0 {
+		expires = time.Now().Add(c.ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[expression]; ok {
+		result := el.Value.(*cachedResult)
+		result.value, result.expires = value, expires
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[expression] = c.lru.PushFront(&cachedResult{expression: expression, value: value, expires: expires})
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedResult).expression)
+	}
+}
+
+// Logging logs every expression with its result or error and its duration
+func Logging(logger *log.Logger) Middleware {
+	return func(next ContextResolver) ContextResolver {
+		return ResolverFunc(func(ctx context.Context, expression string) (float64, error) {
+			start := time.Now()
+			v, err := next.ResolveContext(ctx, expression)
+			if err != nil {
+				logger.Printf("resolve %q failed in %s - %s", expression, time.Since(start), err)
+			} else {
+				logger.Printf("resolve %q = %g in %s", expression, v, time.Since(start))
+			}
+			return v, err
+		})
+	}
+}
+
+// Timeout fails an expression which is not resolved within d with context.DeadlineExceeded.
+// A resolver which ignores its context keeps running in the background until it returns.
+func Timeout(d time.Duration) Middleware {
+	return func(next ContextResolver) ContextResolver {
+		return ResolverFunc(func(ctx context.Context, expression string) (float64, error) {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			type result struct {
+				value float64
+				err   error
+			}
+			done := make(chan result, 1)
+			go func() {
+				v, err := next.ResolveContext(ctx, expression)
+				done <- result{v, err}
+			}()
+			select {
+			case r := <-done:
+				return r.value, r.err
+			case <-ctx.Done():
+				return 0, fmt.Errorf("resolve %q: %w", expression, ctx.Err())
+			}
+		})
+	}
+}
+
+// Fallback resolves with secondary the expressions which the wrapped resolver fails to resolve,
+// unless the context of the caller is done
+func Fallback(secondary ContextResolver) Middleware {
+	return func(next ContextResolver) ContextResolver {
+		return ResolverFunc(func(ctx context.Context, expression string) (float64, error) {
+			v, err := next.ResolveContext(ctx, expression)
+			if err == nil || ctx.Err() != nil {
+				return v, err
+			}
+			return secondary.ResolveContext(ctx, expression)
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package embed_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/seungkyua/go-test/interface/embed"
+)
+
+// countingResolver counts its calls and resolves with the arithmetic resolver
+type countingResolver struct {
+	calls atomic.Int64
+}
+
+func (r *countingResolver) Resolve(expression string) (float64, error) {
+	return r.ResolveSession(nil, expression)
+}
+
+func (r *countingResolver) ResolveSession(s *embed.Session, expression string) (float64, error) {
+	r.calls.Add(1)
+	return embed.ArithmeticResolver{}.ResolveSession(s, expression)
+}
+
+func TestWithContext(t *testing.T) {
+	r := &countingResolver{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := embed.WithContext(r).ResolveContext(ctx, "1 + 1"); !errors.Is(err, context.Canceled) || r.calls.Load() != 0 {
+		t.Errorf("want canceled without a call got (%v, %d calls)", err, r.calls.Load())
+	}
+
+	// a session resolver resolves in the session of the context
+	s := embed.NewSession()
+	s.Set("x", 2)
+	v, err := embed.WithContext(embed.ArithmeticResolver{}).ResolveContext(embed.ContextWithSession(context.Background(), s), "x * 3")
+	if err != nil || v != 6 {
+		t.Errorf("want (6) got (%g, %v)", v, err)
+	}
+}
+
+func TestCacheMiddleware(t *testing.T) {
+	r := &countingResolver{}
+	c := embed.Calculator{Resolver: r, Middleware: []embed.Middleware{embed.Cache(2)}}
+
+	for _, expression := range []string{"1 + 1", "1 + 1", "2 + 2", "3 + 3", "1 + 1", "1 / 0", "1 / 0"} {
+		_, _ = c.Process(strings.NewReader(expression))
+	}
+	// 1 + 1 is evicted by 3 + 3 and errors are not cached
+	if r.calls.Load() != 6 {
+		t.Errorf("want 6 calls got (%d)", r.calls.Load())
+	}
+
+	// expressions of a session are not cached
+	r.calls.Store(0)
+	c.Session = embed.NewSession()
+	for _, expression := range []string{"x = 1", "x + 1", "x = 2", "x + 1"} {
+		if _, err := c.Process(strings.NewReader(expression)); err != nil {
+			t.Fatalf("%s: unexpected error - %s", expression, err)
+		}
+	}
+	if last, _ := c.Session.Get("_"); last != 3 || r.calls.Load() != 4 {
+		t.Errorf("want (3) after 4 calls got (%g) after %d", last, r.calls.Load())
+	}
+}
+
+func TestCacheTTLMiddleware(t *testing.T) {
+	r := &countingResolver{}
+	c := embed.Calculator{Resolver: r, Middleware: []embed.Middleware{embed.CacheTTL(10, 100*time.Millisecond)}}
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Process(strings.NewReader("1 + 1")); err != nil {
+			t.Fatalf("unexpected error - %s", err)
+		}
+	}
+	if r.calls.Load() != 1 {
+		t.Errorf("want 1 call got (%d)", r.calls.Load())
+	}
+
+	// an expired result is resolved again
+	time.Sleep(150 * time.Millisecond)
+	if _, err := c.Process(strings.NewReader("1 + 1")); err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if r.calls.Load() != 2 {
+		t.Errorf("want 2 calls got (%d)", r.calls.Load())
+	}
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	c := embed.Calculator{Middleware: []embed.Middleware{embed.Logging(log.New(&buf, "", 0))}}
+	_, _ = c.ProcessAll(strings.NewReader("2 * 21\n1 / 0\n"))
+
+	out := buf.String()
+	if !strings.Contains(out, `resolve "2 * 21" = 42 in`) || !strings.Contains(out, `resolve "1 / 0" failed in`) ||
+		!strings.Contains(out, "division by zero") {
+		t.Errorf("unexpected log\n%s", out)
+	}
+}
+
+// slowResolver ignores its context
+type slowResolver struct{ delay time.Duration }
+
+func (r slowResolver) Resolve(expression string) (float64, error) {
+	time.Sleep(r.delay)
+	return 1, nil
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	c := embed.Calculator{Resolver: slowResolver{time.Second}, Middleware: []embed.Middleware{embed.Timeout(10 * time.Millisecond)}}
+	start := time.Now()
+	if _, err := c.Process(strings.NewReader("1")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want deadline exceeded got (%v)", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("want the timeout to return early got %s", time.Since(start))
+	}
+
+	c.Resolver = slowResolver{}
+	if v, err := c.Process(strings.NewReader("1")); err != nil || v != 1 {
+		t.Errorf("want (1) got (%g, %v)", v, err)
+	}
+}
+
+// downResolver fails every expression
+type downResolver struct{}
+
+func (downResolver) Resolve(expression string) (float64, error) {
+	return 0, errors.New("remote resolver is down")
+}
+
+func TestFallbackMiddleware(t *testing.T) {
+	c := embed.Calculator{
+		Resolver:   downResolver{},
+		Middleware: []embed.Middleware{embed.Fallback(embed.WithContext(embed.ArithmeticResolver{}))},
+	}
+	if v, err := c.Process(strings.NewReader("0.5 * 4")); err != nil || v != 2 {
+		t.Errorf("want the fallback result (2) got (%g, %v)", v, err)
+	}
+
+	// the fallback is not used when the caller is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.ProcessContext(ctx, strings.NewReader("1")); !errors.Is(err, context.Canceled) {
+		t.Errorf("want canceled got (%v)", err)
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	trace := func(name string) embed.Middleware {
+		return func(next embed.ContextResolver) embed.ContextResolver {
+			return embed.ResolverFunc(func(ctx context.Context, expression string) (float64, error) {
+				order = append(order, name)
+				return next.ResolveContext(ctx, expression)
+			})
+		}
+	}
+	r := embed.Chain(embed.WithContext(embed.ArithmeticResolver{}), trace("outer"), trace("inner"))
+	if _, err := r.ResolveContext(context.Background(), "1"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(order, ",") != "outer,inner" {
+		t.Errorf("want outer,inner got (%v)", order)
+	}
+}
+
+func TestProcessAllContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := embed.Calculator{Middleware: []embed.Middleware{func(next embed.ContextResolver) embed.ContextResolver {
+		return embed.ResolverFunc(func(ctx context.Context, expression string) (float64, error) {
+			cancel()
+			return next.ResolveContext(ctx, expression)
+		})
+	}}}
+	results, err := c.ProcessAllContext(ctx, strings.NewReader("1\n2\n3\n"))
+	if !errors.Is(err, context.Canceled) || len(results) != 1 {
+		t.Errorf("want canceled after one result got (%+v, %v)", results, err)
+	}
+}
@@ -0,0 +1,213 @@
+package embed
+
+import (
+	"errors"
+	"strconv"
+)
+
+// parser is a recursive descent parser of the grammar
+//
+//	statement  = [ identifier "=" ] expression
+//	expression = term { ("+" | "-") term }
+//	term       = unary { ("*" | "/" | "%") unary }
+//	unary      = ("-" | "+") unary | power
+//	power      = primary [ "^" unary ]
+//	primary    = number | identifier | call | "(" expression ")"
+//	call       = identifier "(" [ expression { "," expression } ] ")"
+//
+// so that ^ binds tighter than a sign and is right associative: -2^2 is -4 and 2^3^2 is 512.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parse(expression string) (Node, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return nil, syntaxErrorf(1, "empty expression")
+	}
+	n, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		if t.kind == tokenRightParen {
+			return nil, syntaxErrorf(t.col, "unbalanced parenthesis")
+		}
+		return nil, syntaxErrorf(t.col, "unexpected %s", t)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// operator consumes the next token when it is one of the operators in ops
+func (p *parser) operator(ops string) (token, bool) {
+	t := p.peek()
+	if t.kind != tokenOperator || len(t.text) != 1 {
+		return t, false
+	}
+	for i := 0; i < len(ops); i++ {
+		if t.text[0] == ops[i] {
+			p.pos++
+			return t, true
+		}
+	}
+	return t, false
+}
+
+func (p *parser) statement() (Node, error) {
+	if len(p.tokens) < 2 || p.tokens[0].kind != tokenIdentifier || p.tokens[1].kind != tokenAssign {
+		return p.expression()
+	}
+	name := p.next()
+	if name.text == lastResult {
+		return nil, syntaxErrorf(name.col, "cannot assign to %s", lastResult)
+	}
+	p.next()
+	value, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	return &AssignNode{col: name.col, name: name.text, value: value}, nil
+}
+
+func (p *parser) expression() (Node, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.operator("+-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryNode{col: op.col, op: op.text[0], left: left, right: right}
+	}
+}
+
+func (p *parser) term() (Node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.operator("*/%")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryNode{col: op.col, op: op.text[0], left: left, right: right}
+	}
+}
+
+func (p *parser) unary() (Node, error) {
+	if op, ok := p.operator("-+"); ok {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryNode{col: op.col, op: op.text[0], operand: operand}, nil
+	}
+	return p.power()
+}
+
+func (p *parser) power() (Node, error) {
+	base, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.operator("^")
+	if !ok {
+		return base, nil
+	}
+	exponent, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return &BinaryNode{col: op.col, op: '^', left: base, right: exponent}, nil
+}
+
+func (p *parser) primary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		value, err := strconv.ParseFloat(t.text, 64)
+		if errors.Is(err, strconv.ErrRange) {
+			return nil, syntaxErrorf(t.col, "number %s out of range", t.text)
+		}
+		if err != nil {
+			return nil, syntaxErrorf(t.col, "invalid number %q", t.text)
+		}
+		return &NumberNode{col: t.col, text: t.text, value: value}, nil
+	case tokenIdentifier:
+		if p.peek().kind == tokenLeftParen {
+			return p.call(t)
+		}
+		return &VariableNode{col: t.col, name: t.text}, nil
+	case tokenLeftParen:
+		n, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		switch next := p.next(); next.kind {
+		case tokenRightParen:
+		case tokenEOF:
+			return nil, syntaxErrorf(t.col, "unbalanced parenthesis")
+		default:
+			return nil, syntaxErrorf(next.col, "unexpected %s", next)
+		}
+		return n, nil
+	case tokenEOF:
+		return nil, syntaxErrorf(t.col, "unexpected end of expression")
+	}
+	return nil, syntaxErrorf(t.col, "unexpected %s", t)
+}
+
+// call parses the arguments of a call of the function name
+func (p *parser) call(name token) (Node, error) {
+	open := p.next()
+	n := &CallNode{col: name.col, name: name.text}
+	if p.peek().kind == tokenRightParen {
+		p.next()
+		return n, nil
+	}
+	for {
+		arg, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		n.args = append(n.args, arg)
+
+		switch next := p.next(); next.kind {
+		case tokenComma:
+		case tokenRightParen:
+			return n, nil
+		case tokenEOF:
+			return nil, syntaxErrorf(open.col, "unbalanced parenthesis")
+		default:
+			return nil, syntaxErrorf(next.col, "unexpected %s", next)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package embed
+
+import (
+	"errors"
+	"io"
+)
+
+// DefaultMaxLineLength is the maximum length of an expression when Calculator.MaxLineLength is not set
+const DefaultMaxLineLength = 64 * 1024
+
+// ErrLineTooLong is returned for a line longer than the maximum line length, the line is skipped
+var ErrLineTooLong = errors.New("expression line too long")
+
+// readChunkSize is the read size of seekable readers
+const readChunkSize = 4096
+
+// maxEmptyReads is the number of successive empty reads after which a reader is given up
+const maxEmptyReads = 100
+
+// readLine reads the next line of r without its "\n" or "\r\n" and without reading past it,
+// so that successive calls on the same reader read successive lines.
+// It reads through the buffer of an io.ByteReader such as a *bufio.Reader, reads seekable readers
+// in chunks and seeks back to the end of the line, and reads other readers one byte at a time.
+// The last line does not need a "\n", io.EOF is returned when there is no line left.
+func readLine(r io.Reader, max int) (string, error) {
+	if max <= 0 {
+		max = DefaultMaxLineLength
+	}
+	line := &lineBuffer{max: max}
+
+	var err error
+	switch rr := r.(type) {
+	case io.ByteReader:
+		err = line.readBytes(rr)
+	case io.ReadSeeker:
+		if _, seekErr := rr.Seek(0, io.SeekCurrent); seekErr == nil {
+			err = line.readChunks(rr)
+		} else {
+			// not seekable after all, such as a pipe
+			err = line.readSingleBytes(r)
+		}
+	default:
+		err = line.readSingleBytes(r)
+	}
+	if err == io.EOF && line.read > 0 {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return line.String()
+}
+
+// lineBuffer collects the bytes of a line up to max, the rest of a longer line is read and discarded
+type lineBuffer struct {
+	max  int
+	buf  []byte
+	read int
+}
+
+func (l *lineBuffer) add(b []byte) {
+	l.read += len(b)
+	// one more byte to tell a trailing '\r' from a line which is too long
+	if room := l.max + 1 - len(l.buf); room > 0 {
+		if len(b) > room {
+			b = b[:room]
+		}
+		l.buf = append(l.buf, b...)
+	}
+}
+
+func (l *lineBuffer) String() (string, error) {
+	line := l.buf
+	if n := len(line); n > 0 && line[n-1] == '\r' && l.read == n {
+		line = line[:n-1]
+	}
+	if l.read > len(line)+1 || len(line) > l.max {
+		return "", ErrLineTooLong
+	}
+	return string(line), nil
+}
+
+func (l *lineBuffer) readBytes(r io.ByteReader) error {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b == '\n' {
+			return nil
+		}
+		l.add([]byte{b})
+	}
+}
+
+func (l *lineBuffer) readChunks(r io.ReadSeeker) error {
+	chunk := make([]byte, readChunkSize)
+	for empty := 0; ; {
+		n, err := r.Read(chunk)
+		for i := 0; i < n; i++ {
+			if chunk[i] != '\n' {
+				continue
+			}
+			l.add(chunk[:i])
+			// give back what follows the line
+			if _, seekErr := r.Seek(int64(i+1-n), io.SeekCurrent); seekErr != nil {
+				return seekErr
+			}
+			return nil
+		}
+		l.add(chunk[:n])
+		if err != nil {
+			return err
+		}
+		if empty = nextEmptyReads(empty, n); empty >= maxEmptyReads {
+			return io.ErrNoProgress
+		}
+	}
+}
+
+func (l *lineBuffer) readSingleBytes(r io.Reader) error {
+	b := make([]byte, 1)
+	for empty := 0; ; {
+		n, err := r.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				return nil
+			}
+			l.add(b)
+		}
+		if err != nil {
+			return err
+		}
+		if empty = nextEmptyReads(empty, n); empty >= maxEmptyReads {
+			return io.ErrNoProgress
+		}
+	}
+}
+
+func nextEmptyReads(empty int, n int) int {
+	if n > 0 {
+		return 0
+	}
+	return empty + 1
+}
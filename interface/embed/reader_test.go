@@ -0,0 +1,159 @@
+package embed_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/seungkyua/go-test/interface/embed"
+)
+
+const readerInput = "1 + 1\r\n2 * 3\n\n10 / 4"
+
+// readers returns a reader of each read strategy over s, a cleanup closes the files
+func readers(t testing.TB, s string) map[string]io.Reader {
+	path := filepath.Join(t.TempDir(), "expressions.txt")
+	if err := os.WriteFile(path, []byte(s), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = file.Close() })
+
+	return map[string]io.Reader{
+		"byte reader": strings.NewReader(s),
+		"bufio":       bufio.NewReader(strings.NewReader(s)),
+		"seeker":      file,
+		"plain":       struct{ io.Reader }{strings.NewReader(s)},
+		"one byte":    iotest.OneByteReader(strings.NewReader(s)),
+		"half":        iotest.HalfReader(strings.NewReader(s)),
+	}
+}
+
+func TestCalculatorProcessReaders(t *testing.T) {
+	for name, r := range readers(t, readerInput) {
+		c := embed.Calculator{}
+		for _, want := range []float64{2, 6} {
+			if got, err := c.Process(r); err != nil || got != want {
+				t.Errorf("%s: want (%g) got (%g, %v)", name, want, got, err)
+			}
+		}
+		if _, err := c.Process(r); !errors.Is(err, embed.ErrNoExpression) {
+			t.Errorf("%s: want no expression for the blank line got (%v)", name, err)
+		}
+		if got, err := c.Process(r); err != nil || got != 2.5 {
+			t.Errorf("%s: want (2.5) got (%g, %v)", name, got, err)
+		}
+		if _, err := c.Process(r); !errors.Is(err, embed.ErrNoExpression) {
+			t.Errorf("%s: want no expression at EOF got (%v)", name, err)
+		}
+	}
+}
+
+func TestCalculatorProcessDoesNotOverConsume(t *testing.T) {
+	for name, r := range readers(t, "1 + 1\nrest of the input\n") {
+		if _, err := (embed.Calculator{}).Process(r); err != nil {
+			t.Fatalf("%s: unexpected error - %s", name, err)
+		}
+		if rest, err := io.ReadAll(r); err != nil || string(rest) != "rest of the input\n" {
+			t.Errorf("%s: want the rest of the input got (%q, %v)", name, rest, err)
+		}
+	}
+}
+
+// stuckReader returns no bytes and no error
+type stuckReader struct{}
+
+func (stuckReader) Read(p []byte) (int, error) { return 0, nil }
+
+func TestCalculatorProcessReadErrors(t *testing.T) {
+	readErr := errors.New("disk failure")
+	tests := []struct {
+		name string
+		r    io.Reader
+		want error
+	}{
+		{"error", iotest.ErrReader(readErr), readErr},
+		{"error after data", io.MultiReader(strings.NewReader("1 + "), iotest.ErrReader(readErr)), readErr},
+		{"no progress", stuckReader{}, io.ErrNoProgress},
+	}
+	for _, tt := range tests {
+		if _, err := (embed.Calculator{}).Process(tt.r); !errors.Is(err, tt.want) {
+			t.Errorf("%s: want (%v) got (%v)", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestCalculatorMaxLineLength(t *testing.T) {
+	for name, r := range readers(t, "1+1+1+1+1\n12345678\r\n1+1\n") {
+		c := embed.Calculator{MaxLineLength: 8}
+		if _, err := c.Process(r); !errors.Is(err, embed.ErrLineTooLong) {
+			t.Errorf("%s: want line too long got (%v)", name, err)
+		}
+		if got, err := c.Process(r); err != nil || got != 12345678 {
+			t.Errorf("%s: want (12345678) got (%g, %v)", name, got, err)
+		}
+		if got, err := c.Process(r); err != nil || got != 2 {
+			t.Errorf("%s: want (2) got (%g, %v)", name, got, err)
+		}
+	}
+
+	results, err := embed.Calculator{MaxLineLength: 4}.ProcessAll(strings.NewReader("1 + 1\n2\n"))
+	if err != nil || len(results) != 2 || !errors.Is(results[0].Err, embed.ErrLineTooLong) || results[1].Value != 2 {
+		t.Errorf("want a line too long result got (%+v, %v)", results, err)
+	}
+}
+
+// nopResolver isolates the reading cost in the benchmarks
+type nopResolver struct{}
+
+func (nopResolver) Resolve(string) (float64, error) { return 0, nil }
+
+func benchmarkProcess(b *testing.B, wrap func(io.Reader) io.Reader) {
+	input := strings.Repeat("( 2 + 4 ) * 10 - 3.5e2 / 7\n", 10000)
+	b.SetBytes(int64(len(input)))
+	c := embed.Calculator{Resolver: nopResolver{}}
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		r := readers(b, input)["seeker"]
+		b.StartTimer()
+
+		r = wrap(r)
+		for {
+			if _, err := c.Process(r); err != nil {
+				break
+			}
+		}
+	}
+}
+
+// BenchmarkProcessUnbuffered reads a file one byte at a time, as Process did before reading was buffered
+func BenchmarkProcessUnbuffered(b *testing.B) {
+	benchmarkProcess(b, func(r io.Reader) io.Reader { return struct{ io.Reader }{r} })
+}
+
+func BenchmarkProcessSeeker(b *testing.B) {
+	benchmarkProcess(b, func(r io.Reader) io.Reader { return r })
+}
+
+func BenchmarkProcessBufio(b *testing.B) {
+	benchmarkProcess(b, func(r io.Reader) io.Reader { return bufio.NewReader(r) })
+}
+
+func BenchmarkProcessAll(b *testing.B) {
+	input := strings.Repeat("( 2 + 4 ) * 10 - 3.5e2 / 7\n", 10000)
+	b.SetBytes(int64(len(input)))
+	c := embed.Calculator{Resolver: nopResolver{}}
+	for i := 0; i < b.N; i++ {
+		if _, err := c.ProcessAll(strings.NewReader(input)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
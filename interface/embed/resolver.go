@@ -0,0 +1,193 @@
+package embed
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// EvalError is an expression which parsed but can not be evaluated, such as a division by zero
+type EvalError struct {
+	Column int
+	Msg    string
+}
+
+func (e *EvalError) Error() string {
+	return fmt.Sprintf("%s at column %d", e.Msg, e.Column)
+}
+
+// ArithmeticResolver evaluates infix expressions of numbers with + - * / % ^, signs and parentheses.
+// Numbers may have a fraction and an exponent such as 1.5e3.
+// ^ is right associative and binds tighter than a sign, % is the remainder of a truncated division.
+// In a session, x = 2 + 3 binds x and later expressions may reference x and _, the previous result.
+// Functions such as max(x, 0) are the built-in functions and Functions.
+type ArithmeticResolver struct {
+	// Functions are callable by name in addition to the built-in functions, which they override
+	Functions map[string]Function
+}
+
+func (r ArithmeticResolver) Resolve(expression string) (float64, error) {
+	return r.ResolveSession(nil, expression)
+}
+
+// ResolveSession resolves expression against the variables of s, a nil s has no variables
+func (r ArithmeticResolver) ResolveSession(s *Session, expression string) (float64, error) {
+	n, err := parse(expression)
+	if err != nil {
+		return 0, err
+	}
+	if s == nil {
+		return r.Eval(n, nil)
+	}
+	return r.Eval(n, s)
+}
+
+// Eval evaluates a parsed expression with the variables of env, a nil env has no variables.
+// Assignments need an env with a Set(name string, value float64) method such as a Session.
+func (r ArithmeticResolver) Eval(n Node, env Env) (float64, error) {
+	return evaluator{env: env, functions: r.Functions}.eval(n)
+}
+
+// function returns a function of functions or a built-in function
+func function(functions map[string]Function, name string) (Function, bool) {
+	if f, ok := functions[name]; ok {
+		return f, true
+	}
+	f, ok := builtinFunctions[name]
+	return f, ok
+}
+
+// evaluator evaluates nodes with the variables of env and functions
+type evaluator struct {
+	env       Env
+	functions map[string]Function
+}
+
+// setter is an Env which can bind variables
+type setter interface {
+	Set(name string, value float64)
+}
+
+func (e evaluator) eval(n Node) (float64, error) {
+	switch n := n.(type) {
+	case *NumberNode:
+		return n.value, nil
+	case *VariableNode:
+		var v float64
+		ok := false
+		if e.env != nil {
+			v, ok = e.env.Get(n.name)
+		}
+		if !ok && n.name == lastResult {
+			return 0, &EvalError{Column: n.col, Msg: "no previous result"}
+		}
+		if !ok {
+			return 0, &EvalError{Column: n.col, Msg: fmt.Sprintf("undefined variable %q", n.name)}
+		}
+		return v, nil
+	case *AssignNode:
+		s, ok := e.env.(setter)
+		if !ok {
+			return 0, &EvalError{Column: n.col, Msg: fmt.Sprintf("assignment to %q needs a session", n.name)}
+		}
+		v, err := e.eval(n.value)
+		if err != nil {
+			return 0, err
+		}
+		s.Set(n.name, v)
+		return v, nil
+	case *CallNode:
+		return e.call(n)
+	case *UnaryNode:
+		v, err := e.eval(n.operand)
+		if err != nil {
+			return 0, err
+		}
+		if n.op == '-' {
+			return -v, nil
+		}
+		return v, nil
+	case *BinaryNode:
+		left, err := e.eval(n.left)
+		if err != nil {
+			return 0, err
+		}
+		right, err := e.eval(n.right)
+		if err != nil {
+			return 0, err
+		}
+		return applyOperator(n.op, left, right, n.col)
+	}
+	return 0, fmt.Errorf("unknown node %T", n)
+}
+
+func (e evaluator) call(n *CallNode) (float64, error) {
+	f, ok := function(e.functions, n.name)
+	if !ok {
+		return 0, &EvalError{Column: n.col, Msg: fmt.Sprintf("unknown function %q", n.name)}
+	}
+	if err := f.check(n.name, len(n.args)); err != nil {
+		return 0, &EvalError{Column: n.col, Msg: err.Error()}
+	}
+
+	args := make([]float64, len(n.args))
+	for i, arg := range n.args {
+		v, err := e.eval(arg)
+		if err != nil {
+			return 0, err
+		}
+		args[i] = v
+	}
+	v, err := f.Call(args...)
+	if err != nil {
+		return 0, &EvalError{Column: n.col, Msg: fmt.Sprintf("%s: %s", n.name, err)}
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, &EvalError{Column: n.col, Msg: fmt.Sprintf("%s%s is not a finite number", n.name, formatArgs(args))}
+	}
+	return v, nil
+}
+
+func formatArgs(args []float64) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for i, arg := range args {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(strconv.FormatFloat(arg, 'g', -1, 64))
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+func applyOperator(op byte, left float64, right float64, col int) (float64, error) {
+	var v float64
+	switch op {
+	case '+':
+		v = left + right
+	case '-':
+		v = left - right
+	case '*':
+		v = left * right
+	case '/':
+		if right == 0 {
+			return 0, &EvalError{Column: col, Msg: "division by zero"}
+		}
+		v = left / right
+	case '%':
+		if right == 0 {
+			return 0, &EvalError{Column: col, Msg: "modulo by zero"}
+		}
+		v = math.Mod(left, right)
+	case '^':
+		v = math.Pow(left, right)
+	default:
+		return 0, &EvalError{Column: col, Msg: fmt.Sprintf("unknown operator %q", op)}
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, &EvalError{Column: col, Msg: fmt.Sprintf("%g %c %g is not a finite number", left, op, right)}
+	}
+	return v, nil
+}
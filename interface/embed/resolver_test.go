@@ -0,0 +1,75 @@
+package embed_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/seungkyua/go-test/interface/embed"
+)
+
+func TestArithmeticResolver(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       float64
+	}{
+		{"2 + 4 * 10", 42},
+		{"( 2 + 4 ) * 10", 60},
+		{"10 - 4 - 3", 3},
+		{"100 / 10 / 5", 2},
+		{"7 % 4 * 2", 6},
+		{"-7 % 4", -3},
+		{"2 ^ 3 ^ 2", 512},
+		{"-2 ^ 2", -4},
+		{"(-2) ^ 2", 4},
+		{"2 ^ -1", 0.5},
+		{"--3", 3},
+		{"+3 - -3", 6},
+		{"1.5 + .5", 2},
+		{"1.5e3 / 1E-1", 15000},
+		{"2.5e+2", 250},
+		{"((1))", 1},
+		{"2*(3+4)*5", 70},
+	}
+	for _, tt := range tests {
+		got, err := embed.ArithmeticResolver{}.Resolve(tt.expression)
+		if err != nil {
+			t.Errorf("%s: unexpected error - %s", tt.expression, err)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: want (%g) got (%g)", tt.expression, tt.want, got)
+		}
+	}
+}
+
+func TestArithmeticResolverErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"( 2 + 4 * 10", "unbalanced parenthesis at column 1"},
+		{"2 + 4 ) * 10", "unbalanced parenthesis at column 7"},
+		{"(2 3)", `unexpected "3" at column 4`},
+		{"2 +", "unexpected end of expression at column 4"},
+		{"2 * * 3", `unexpected "*" at column 5`},
+		{"", "empty expression at column 1"},
+		{"2 $ 3", `unexpected character '$' at column 3`},
+		{"1.2.3", `invalid number "1.2.3" at column 1`},
+		{"1e999", "number 1e999 out of range at column 1"},
+		{"1 / (2 - 2)", "division by zero at column 3"},
+		{"1 % 0", "modulo by zero at column 3"},
+		{"(-8) ^ 0.5", "-8 ^ 0.5 is not a finite number at column 6"},
+	}
+	for _, tt := range tests {
+		_, err := embed.ArithmeticResolver{}.Resolve(tt.expression)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%q: want (%s) got (%v)", tt.expression, tt.want, err)
+		}
+	}
+
+	var syntaxErr *embed.SyntaxError
+	if _, err := (embed.ArithmeticResolver{}).Resolve("( 2 + 4 * 10"); !errors.As(err, &syntaxErr) || syntaxErr.Column != 1 {
+		t.Errorf("want SyntaxError at column 1 got (%v)", err)
+	}
+}
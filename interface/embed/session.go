@@ -0,0 +1,83 @@
+package embed
+
+import (
+	"sort"
+	"sync"
+)
+
+// lastResult is the variable of the previous result of a session
+const lastResult = "_"
+
+// SessionResolver is a MathResolver which keeps state between the expressions of a session,
+// such as variables. Calculator uses it instead of Resolve when it has a Session.
+type SessionResolver interface {
+	MathResolver
+	ResolveSession(s *Session, expression string) (float64, error)
+}
+
+// Session is the state shared by the expressions of a Calculator: the variables bound by
+// assignments like x = 2 + 3 and the previous result, referenced as _.
+// The zero value is an empty session. It is safe for concurrent use.
+type Session struct {
+	mu      sync.Mutex
+	vars    map[string]float64
+	last    float64
+	hasLast bool
+}
+
+func NewSession() *Session {
+	return &Session{vars: make(map[string]float64)}
+}
+
+// Get returns the value of a variable, _ is the previous result
+func (s *Session) Get(name string) (float64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if name == lastResult {
+		return s.last, s.hasLast
+	}
+	v, ok := s.vars[name]
+	return v, ok
+}
+
+// Set binds a variable, _ can not be set
+func (s *Session) Set(name string, value float64) {
+	if name == lastResult {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.vars == nil {
+		s.vars = make(map[string]float64)
+	}
+	s.vars[name] = value
+}
+
+// Names returns the bound variables in order
+func (s *Session) Names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.vars))
+	for name := range s.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Reset removes the variables and the previous result
+func (s *Session) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.vars = make(map[string]float64)
+	s.last, s.hasLast = 0, false
+}
+
+// setLast records the result of an expression as _
+func (s *Session) setLast(value float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last, s.hasLast = value, true
+}
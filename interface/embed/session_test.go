@@ -0,0 +1,103 @@
+package embed_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/seungkyua/go-test/interface/embed"
+)
+
+func TestCalculatorSession(t *testing.T) {
+	session := embed.NewSession()
+	c := embed.Calculator{Session: session}
+	results, err := c.ProcessAll(strings.NewReader(`x = 2 + 3
+x * 10
+_ + 1
+rate_2 = _ / x
+y + 1
+_ = 1
+2 = 3
+x = x + rate_2`))
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+
+	want := []struct {
+		value float64
+		err   string
+	}{
+		{5, ""},
+		{50, ""},
+		{51, ""},
+		{10.2, ""},
+		{0, `undefined variable "y" at column 1`},
+		{0, "cannot assign to _ at column 1"},
+		{0, `unexpected "=" at column 3`},
+		{15.2, ""},
+	}
+	for i, w := range want {
+		got := results[i]
+		if got.Value != w.value || (got.Err == nil) != (w.err == "") || (got.Err != nil && got.Err.Error() != w.err) {
+			t.Errorf("line %d: want (%+v) got (%+v)", got.Line, w, got)
+		}
+	}
+
+	if names := session.Names(); !reflect.DeepEqual(names, []string{"rate_2", "x"}) {
+		t.Errorf("unexpected variables (%v)", names)
+	}
+	if last, ok := session.Get("_"); !ok || last != 15.2 {
+		t.Errorf("want _ (15.2) got (%g, %t)", last, ok)
+	}
+
+	session.Reset()
+	if _, err := c.Process(strings.NewReader("_ * 2")); err == nil || err.Error() != "no previous result at column 1" {
+		t.Errorf("want no previous result got (%v)", err)
+	}
+}
+
+func TestResolveWithoutSession(t *testing.T) {
+	if _, err := (embed.ArithmeticResolver{}).Resolve("x + 1"); err == nil || err.Error() != `undefined variable "x" at column 1` {
+		t.Errorf("want undefined variable got (%v)", err)
+	}
+	if _, err := (embed.ArithmeticResolver{}).Resolve("x = 1"); err == nil || err.Error() != `assignment to "x" needs a session at column 1` {
+		t.Errorf("want assignment error got (%v)", err)
+	}
+}
+
+func TestCalculatorSessionStatelessResolver(t *testing.T) {
+	// a resolver which is not a SessionResolver still updates _
+	session := embed.NewSession()
+	c := embed.Calculator{Resolver: MathResolverStub{}, Session: session}
+	if _, err := c.Process(strings.NewReader("2 + 4 * 10")); err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if last, ok := session.Get("_"); !ok || last != 42 {
+		t.Errorf("want _ (42) got (%g, %t)", last, ok)
+	}
+}
+
+func TestSessionZeroValue(t *testing.T) {
+	session := &embed.Session{}
+	if _, ok := session.Get("x"); ok {
+		t.Error("want no variable in an empty session")
+	}
+	c := embed.Calculator{Session: session}
+	results, err := c.ProcessAll(strings.NewReader("x = 4\nx * _"))
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if results[0].Err != nil || results[1].Err != nil || results[1].Value != 16 {
+		t.Errorf("unexpected results %+v", results)
+	}
+	if names := session.Names(); !reflect.DeepEqual(names, []string{"x"}) {
+		t.Errorf("want [x] got (%v)", names)
+	}
+
+	session = &embed.Session{}
+	session.Reset()
+	session.Set("y", 1)
+	if v, ok := session.Get("y"); !ok || v != 1 {
+		t.Errorf("want y (1) got (%g, %t)", v, ok)
+	}
+}
@@ -4,22 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-)
-
-type WidgetResponse struct {
-	Key    string `json:"key"`
-	StartX int    `json:"startX"`
-	StartY int    `json:"startY"`
-	SizeX  int    `json:"sizeX"`
-	SizeY  int    `json:"sizeY"`
-}
 
-type CreateDashboardRequest struct {
-	GroupName string           `json:"groupName"`
-	SizeX     int              `json:"sizeX"`
-	SizeY     int              `json:"sizeY"`
-	Widgets   []WidgetResponse `json:"widgets"`
-}
+	"github.com/seungkyua/go-test/dashboard"
+)
 
 func main() {
 	input := `
@@ -45,14 +32,14 @@ func main() {
 		]
     `
 
-	var dashboard []CreateDashboardRequest
-	err := Unmarshal([]byte(input), &dashboard)
+	var groups []dashboard.CreateDashboardRequest
+	err := Unmarshal([]byte(input), &groups)
 	if err != nil {
 		log.Fatal("error !!!!")
 	}
-	fmt.Printf("%+v\n\n", dashboard)
+	fmt.Printf("%+v\n\n", groups)
 
-	b, err := json.Marshal(dashboard)
+	b, err := json.Marshal(groups)
 	if err != nil {
 		log.Fatalf("Unable to unmarshal JSON due to %s", err)
 	}
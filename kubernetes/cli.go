@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+)
+
+const cliUsage = `Usage: tks-policy <command> [flags]
+
+Commands:
+  clusters list                      list the TKSClusters of the organization
+  cluster health <cluster-id>        check the health of a user cluster
+  templates list                     list the TKSPolicyTemplates
+  templates get <name>               show a TKSPolicyTemplate
+  templates rollout [name]           show the rollout progress of the templates
+  policies list                      list the TKSPolicies
+  policies get <name>                show a TKSPolicy
+  policies apply -f <file>           validate and apply a TKSPolicy (- reads stdin)
+  policies delete <name>             delete a TKSPolicy and wait until it is removed from its clusters
+
+Flags:
+`
+
+// errUsage is returned for invalid command lines, the usage is printed with the error
+var errUsage = errors.New("invalid usage")
+
+// cli runs the tks-policy commands. The client constructors are fields so that tests can replace them with fakes.
+type cli struct {
+	out    io.Writer
+	errOut io.Writer
+	in     io.Reader
+
+	namespace    string
+	kubeconfig   string
+	output       string
+	filename     string
+	fieldManager string
+	force        bool
+	wait         time.Duration
+
+	adminClients func(kubeconfig string) (kubernetes.Interface, dynamic.Interface, error)
+	userClient   func(config *rest.Config) (kubernetes.Interface, error)
+}
+
+func newCLI(out io.Writer, errOut io.Writer, in io.Reader) *cli {
+	return &cli{
+		out:    out,
+		errOut: errOut,
+		in:     in,
+		adminClients: func(kubeconfig string) (kubernetes.Interface, dynamic.Interface, error) {
+			return GetAdminClientSet(kubeconfig)
+		},
+		userClient: func(config *rest.Config) (kubernetes.Interface, error) {
+			return kubernetes.NewForConfig(config)
+		},
+	}
+}
+
+func (c *cli) flagSet() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("tks-policy", pflag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringVarP(&c.namespace, "namespace", "n", "", "organization namespace of the TKS resources")
+	flags.StringVar(&c.kubeconfig, "kubeconfig", "", "kubeconfig of the admin cluster (defaults to $KUBECONFIG, ~/.kube/config or in-cluster)")
+	flags.StringVarP(&c.output, "output", "o", OutputTable, "output format: table, json or yaml")
+	flags.StringVarP(&c.filename, "filename", "f", "", "policies apply: file with the TKSPolicy in YAML or JSON")
+	flags.StringVar(&c.fieldManager, "field-manager", TKSPolicyFieldManager, "policies apply: server-side apply field manager")
+	flags.BoolVar(&c.force, "force", false, "policies apply: take over fields owned by other field managers")
+	flags.DurationVar(&c.wait, "wait", 2*time.Minute, "policies delete: how long to wait for the clusters, 0 doesn't wait")
+	return flags
+}
+
+// run parses args and executes the command. Flags may be given before or after the command.
+func (c *cli) run(args []string) error {
+	flags := c.flagSet()
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, pflag.ErrHelp) {
+			c.usage(flags)
+			return nil
+		}
+		return fmt.Errorf("%w: %s", errUsage, err)
+	}
+	switch c.output {
+	case OutputTable, OutputJSON, OutputYAML:
+	default:
+		return fmt.Errorf("%w: unknown output format %q", errUsage, c.output)
+	}
+
+	cmd := flags.Args()
+	if len(cmd) < 2 {
+		return fmt.Errorf("%w: missing command", errUsage)
+	}
+	operands := cmd[2:]
+
+	switch cmd[0] + " " + cmd[1] {
+	case "clusters list":
+		return c.withNamespace(operands, 0, c.listClusters)
+	case "cluster health":
+		if len(operands) != 1 {
+			return fmt.Errorf("%w: cluster health takes a cluster id", errUsage)
+		}
+		return c.clusterHealth(operands[0])
+	case "templates list":
+		return c.withNamespace(operands, 0, c.listTemplates)
+	case "templates get":
+		return c.withNamespace(operands, 1, c.getTemplate)
+	case "templates rollout":
+		if len(operands) > 1 {
+			return fmt.Errorf("%w: templates rollout takes at most one template", errUsage)
+		}
+		return c.withNamespace(nil, 0, func(dc dynamic.Interface, _ []string) error {
+			return c.templateRollout(dc, operands)
+		})
+	case "policies list":
+		return c.withNamespace(operands, 0, c.listPolicies)
+	case "policies get":
+		return c.withNamespace(operands, 1, c.getPolicy)
+	case "policies apply":
+		return c.applyPolicy(operands)
+	case "policies delete":
+		return c.withNamespace(operands, 1, c.deletePolicy)
+	}
+	return fmt.Errorf("%w: unknown command %q", errUsage, strings.Join(cmd[:2], " "))
+}
+
+func (c *cli) usage(flags *pflag.FlagSet) {
+	fmt.Fprint(c.errOut, cliUsage)
+	fmt.Fprint(c.errOut, flags.FlagUsages())
+}
+
+// withNamespace checks the operand count and the namespace flag, then runs fn with the admin dynamic client.
+func (c *cli) withNamespace(operands []string, n int, fn func(dc dynamic.Interface, operands []string) error) error {
+	if len(operands) != n {
+		return fmt.Errorf("%w: want %d argument(s) got %d", errUsage, n, len(operands))
+	}
+	if c.namespace == "" {
+		return fmt.Errorf("%w: --namespace is required", errUsage)
+	}
+	_, dc, err := c.adminClients(c.kubeconfig)
+	if err != nil {
+		return err
+	}
+	return fn(dc, operands)
+}
+
+func (c *cli) listClusters(dc dynamic.Interface, _ []string) error {
+	tksclusters, err := GetTKSclusters(dc, c.namespace)
+	if err != nil {
+		return err
+	}
+	return c.print(tksclusters, []string{"NAME", "CLUSTER", "STATUS", "TKSPROXY", "LAST UPDATE"}, func() [][]string {
+		rows := make([][]string, 0, len(tksclusters))
+		for _, tkscluster := range tksclusters {
+			rows = append(rows, []string{tkscluster.Name, tkscluster.Spec.ClusterName, tkscluster.Status.Status,
+				tkscluster.Status.TKSProxy.Status, tkscluster.Status.LastUpdate})
+		}
+		return rows
+	})
+}
+
+func (c *cli) clusterHealth(clusterID string) error {
+	clientSet, _, err := c.adminClients(c.kubeconfig)
+	if err != nil {
+		return err
+	}
+	config, err := GetUserClusterConfig(clientSet, clusterID)
+	if err != nil {
+		return err
+	}
+	userClientSet, err := c.userClient(config)
+	if err != nil {
+		return fmt.Errorf("fail to create the k8s client set of %s: %w", clusterID, err)
+	}
+	report, err := GetClusterHealth(userClientSet)
+	if err != nil {
+		return err
+	}
+	if c.output != OutputTable {
+		return c.print(report, nil, nil)
+	}
+
+	sections := []struct {
+		header []string
+		rows   [][]string
+	}{
+		{[]string{"CLUSTER", "VERSION", "HEALTHY", "API LATENCY"}, [][]string{
+			{clusterID, report.ServerVersion, strconv.FormatBool(report.Healthy), fmt.Sprintf("%dms", report.APILatencyMs)},
+		}},
+		{[]string{"NODE", "READY", "KUBELET"}, nil},
+		{[]string{"COMPONENT", "HEALTHY", "READY"}, nil},
+	}
+	for _, node := range report.Nodes {
+		sections[1].rows = append(sections[1].rows, []string{node.Name, strconv.FormatBool(node.Ready), node.KubeletVersion})
+	}
+	for _, component := range report.ControlPlane {
+		sections[2].rows = append(sections[2].rows, []string{component.Name, strconv.FormatBool(component.Healthy),
+			fmt.Sprintf("%d/%d", component.Ready, component.Pods)})
+	}
+	for i, section := range sections {
+		if i > 0 {
+			fmt.Fprintln(c.out)
+		}
+		if err := c.printTable(section.header, section.rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *cli) listTemplates(dc dynamic.Interface, _ []string) error {
+	tksPolicyTemplates, err := GetTKSPolicyTemplates(dc, c.namespace)
+	if err != nil {
+		return err
+	}
+	return c.printTemplates(tksPolicyTemplates, tksPolicyTemplates)
+}
+
+func (c *cli) getTemplate(dc dynamic.Interface, operands []string) error {
+	tksPolicyTemplate, err := GetTKSPolicyTemplate(dc, c.namespace, operands[0])
+	if err != nil {
+		return err
+	}
+	return c.printTemplates(tksPolicyTemplate, []TKSPolicyTemplate{*tksPolicyTemplate})
+}
+
+func (c *cli) printTemplates(v interface{}, tksPolicyTemplates []TKSPolicyTemplate) error {
+	return c.print(v, []string{"NAME", "TEMPLATE ID", "KIND", "VERSION", "CLUSTERS"}, func() [][]string {
+		rows := make([][]string, 0, len(tksPolicyTemplates))
+		for _, t := range tksPolicyTemplates {
+			rows = append(rows, []string{t.Name, t.Labels["tks/policy-template-id"], t.Spec.CRD.Spec.Names.Kind,
+				t.Spec.Version, strings.Join(t.Spec.Clusters, ",")})
+		}
+		return rows
+	})
+}
+
+func (c *cli) templateRollout(dc dynamic.Interface, operands []string) error {
+	var rollouts []TemplateRollout
+	if len(operands) == 1 {
+		tksPolicyTemplate, err := GetTKSPolicyTemplate(dc, c.namespace, operands[0])
+		if err != nil {
+			return err
+		}
+		rollouts = []TemplateRollout{GetTemplateRollout(*tksPolicyTemplate)}
+	} else {
+		var err error
+		if rollouts, err = GetTemplateRollouts(dc, c.namespace); err != nil {
+			return err
+		}
+	}
+
+	return c.print(rollouts, []string{"TEMPLATE", "VERSION", "UP-TO-DATE", "PROGRESS", "APPLYING", "ERROR", "OUTDATED"}, func() [][]string {
+		rows := make([][]string, 0, len(rollouts))
+		for _, rollout := range rollouts {
+			rows = append(rows, []string{rollout.Template, rollout.Version,
+				fmt.Sprintf("%d/%d", rollout.UpToDate, rollout.TargetClusters),
+				fmt.Sprintf("%.0f%%", rollout.Progress),
+				strconv.Itoa(len(rollout.Applying)), strconv.Itoa(len(rollout.Error)), strconv.Itoa(len(rollout.Outdated))})
+		}
+		return rows
+	})
+}
+
+func (c *cli) listPolicies(dc dynamic.Interface, _ []string) error {
+	tksPolicies, err := GetTKSPolicies(dc, c.namespace)
+	if err != nil {
+		return err
+	}
+	return c.printPolicies(tksPolicies, tksPolicies)
+}
+
+func (c *cli) getPolicy(dc dynamic.Interface, operands []string) error {
+	tksPolicy, err := GetTKSPolicy(dc, c.namespace, operands[0])
+	if err != nil {
+		return err
+	}
+	return c.printPolicies(tksPolicy, []TKSPolicy{*tksPolicy})
+}
+
+func (c *cli) printPolicies(v interface{}, tksPolicies []TKSPolicy) error {
+	return c.print(v, []string{"NAME", "TEMPLATE", "ENFORCEMENT", "CLUSTERS", "READY"}, func() [][]string {
+		rows := make([][]string, 0, len(tksPolicies))
+		for _, p := range tksPolicies {
+			ready := 0
+			for _, status := range p.Status.Clusters {
+				if status.ConstraintStatus == "ready" {
+					ready++
+				}
+			}
+			enforcementAction := p.Spec.EnforcementAction
+			if enforcementAction == "" {
+				enforcementAction = "deny"
+			}
+			rows = append(rows, []string{p.Name, p.Spec.Template, enforcementAction, strings.Join(p.Spec.Clusters, ","),
+				fmt.Sprintf("%d/%d", ready, len(p.Spec.Clusters))})
+		}
+		return rows
+	})
+}
+
+// applyPolicy reads a TKSPolicy from --filename, checks its params against the template schema and applies it.
+// The namespace defaults to the one of the file, a different --namespace is an error.
+func (c *cli) applyPolicy(operands []string) error {
+	if len(operands) != 0 || c.filename == "" {
+		return fmt.Errorf("%w: policies apply takes -f <file>", errUsage)
+	}
+
+	var data []byte
+	var err error
+	if c.filename == "-" {
+		data, err = io.ReadAll(c.in)
+	} else {
+		data, err = os.ReadFile(c.filename)
+	}
+	if err != nil {
+		return err
+	}
+
+	var tksPolicy TKSPolicy
+	if err := yaml.UnmarshalStrict(data, &tksPolicy); err != nil {
+		return &ResourceError{Op: "read", Resource: TKSPolicyGVR.Resource, Name: c.filename, Kind: ErrConversion, Err: err}
+	}
+	switch {
+	case c.namespace == "":
+		c.namespace = tksPolicy.Namespace
+	case tksPolicy.Namespace != "" && tksPolicy.Namespace != c.namespace:
+		return fmt.Errorf("%w: the namespace of the policy (%s) does not match --namespace (%s)",
+			errUsage, tksPolicy.Namespace, c.namespace)
+	}
+
+	return c.withNamespace(nil, 0, func(dc dynamic.Interface, _ []string) error {
+		if err := CheckTKSPolicyParams(dc, c.namespace, &tksPolicy); err != nil {
+			return err
+		}
+		applied, err := ApplyTKSPolicy(dc, c.namespace, &tksPolicy, c.fieldManager, c.force)
+		if err != nil {
+			return err
+		}
+		return c.printPolicies(applied, []TKSPolicy{*applied})
+	})
+}
+
+func (c *cli) deletePolicy(dc dynamic.Interface, operands []string) error {
+	if err := DeleteTKSPolicy(dc, c.namespace, operands[0], DeleteOptions{Timeout: c.wait}); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(c.out, "tkspolicy/%s deleted\n", operands[0])
+	return err
+}
+
+// print writes v as JSON or YAML, or as a table of the rows built by tableRows.
+func (c *cli) print(v interface{}, header []string, tableRows func() [][]string) error {
+	var out []byte
+	var err error
+	switch c.output {
+	case OutputJSON:
+		out, err = json.MarshalIndent(v, "", "  ")
+		out = append(out, '\n')
+	case OutputYAML:
+		out, err = yaml.Marshal(v)
+	default:
+		return c.printTable(header, tableRows())
+	}
+	if err != nil {
+		return err
+	}
+	_, err = c.out.Write(out)
+	return err
+}
+
+func (c *cli) printTable(header []string, rows [][]string) error {
+	w := tabwriter.NewWriter(c.out, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		for i := range row {
+			if row[i] == "" {
+				row[i] = "-"
+			}
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
+)
+
+func newTestCLI(dc dynamic.Interface, clientSet kubernetes.Interface) (*cli, *bytes.Buffer) {
+	var out bytes.Buffer
+	c := newCLI(&out, &bytes.Buffer{}, strings.NewReader(""))
+	c.adminClients = func(kubeconfig string) (kubernetes.Interface, dynamic.Interface, error) {
+		return clientSet, dc, nil
+	}
+	return c, &out
+}
+
+func newCLIObjects() []runtime.Object {
+	template := newUnstructured("TKSPolicyTemplate", "org", "k8srequiredlabels", map[string]interface{}{
+		"version":  "v1.0.0",
+		"clusters": []interface{}{"c1", "c2"},
+		"crd": map[string]interface{}{"spec": map[string]interface{}{
+			"names": map[string]interface{}{"kind": "K8sRequiredLabels"},
+			"validation": map[string]interface{}{"openAPIV3Schema": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"labels": map[string]interface{}{"type": "array"}},
+			}},
+		}},
+	})
+	template.SetLabels(map[string]string{"tks/policy-template-id": "tid1"})
+	template.Object["status"] = map[string]interface{}{"templateStatus": map[string]interface{}{
+		"c1": map[string]interface{}{"constraintTemplateStatus": "ready", "version": "v1.0.0"},
+	}}
+
+	policy := newUnstructured("TKSPolicy", "org", "p1", map[string]interface{}{
+		"template": "k8srequiredlabels",
+		"clusters": []interface{}{"c1", "c2"},
+	})
+	policy.Object["status"] = map[string]interface{}{"clusters": map[string]interface{}{
+		"c1": map[string]interface{}{"constraintStatus": "ready"},
+	}}
+
+	cluster := newUnstructured("TKSCluster", "org", "c1", map[string]interface{}{"clusterName": "c1", "context": "c1"})
+	cluster.Object["status"] = map[string]interface{}{"status": "running", "tksproxy": map[string]interface{}{"status": "ready"}}
+
+	return []runtime.Object{template, policy, cluster}
+}
+
+func TestCLIList(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"clusters", "list", "-n", "org"}, []string{"NAME", "TKSPROXY", "c1", "running", "ready"}},
+		{[]string{"templates", "list", "--namespace=org"}, []string{"TEMPLATE ID", "k8srequiredlabels", "tid1", "K8sRequiredLabels", "c1,c2"}},
+		{[]string{"-n", "org", "templates", "rollout"}, []string{"UP-TO-DATE", "k8srequiredlabels", "1/2", "50%"}},
+		{[]string{"policies", "list", "-n", "org"}, []string{"ENFORCEMENT", "p1", "deny", "1/2"}},
+		{[]string{"policies", "get", "p1", "-n", "org"}, []string{"p1", "k8srequiredlabels"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args[:2], " "), func(t *testing.T) {
+			c, out := newTestCLI(newFakeDynamicClient(newCLIObjects()...), nil)
+			if err := c.run(tt.args); err != nil {
+				t.Fatalf("unexpected error - %s", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("want %q in\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestCLIOutput(t *testing.T) {
+	c, out := newTestCLI(newFakeDynamicClient(newCLIObjects()...), nil)
+	if err := c.run([]string{"templates", "get", "k8srequiredlabels", "-n", "org", "-o", "json"}); err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	var tksPolicyTemplate TKSPolicyTemplate
+	if err := json.Unmarshal(out.Bytes(), &tksPolicyTemplate); err != nil || tksPolicyTemplate.Spec.Version != "v1.0.0" {
+		t.Errorf("want template json got (%v)\n%s", err, out.String())
+	}
+
+	c, out = newTestCLI(newFakeDynamicClient(newCLIObjects()...), nil)
+	if err := c.run([]string{"templates", "rollout", "k8srequiredlabels", "-n", "org", "-o", "yaml"}); err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	var rollouts []TemplateRollout
+	if err := yaml.Unmarshal(out.Bytes(), &rollouts); err != nil || len(rollouts) != 1 || rollouts[0].UpToDate != 1 {
+		t.Errorf("want rollout yaml got (%v)\n%s", err, out.String())
+	}
+}
+
+func TestCLIUsageErrors(t *testing.T) {
+	tests := [][]string{
+		{},
+		{"clusters"},
+		{"clusters", "delete", "-n", "org"},
+		{"clusters", "list"},
+		{"templates", "get", "-n", "org"},
+		{"policies", "list", "-n", "org", "-o", "xml"},
+		{"policies", "apply", "-n", "org"},
+		{"cluster", "health"},
+		{"policies", "list", "--unknown"},
+	}
+	for _, args := range tests {
+		c, _ := newTestCLI(newFakeDynamicClient(), nil)
+		if err := c.run(args); !errors.Is(err, errUsage) {
+			t.Errorf("%v: want (%v) got (%v)", args, errUsage, err)
+		}
+	}
+}
+
+func TestCLINotFound(t *testing.T) {
+	c, _ := newTestCLI(newFakeDynamicClient(), nil)
+	if err := c.run([]string{"policies", "get", "p1", "-n", "org"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("want (%v) got (%v)", ErrNotFound, err)
+	}
+}
+
+func TestCLIApplyPolicy(t *testing.T) {
+	dc := newFakeDynamicClient(newCLIObjects()...)
+	var applied []byte
+	dc.PrependReactor("patch", TKSPolicyGVR.Resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+		applied = action.(k8stesting.PatchAction).GetPatch()
+		obj := &unstructured.Unstructured{}
+		if err := json.Unmarshal(applied, &obj.Object); err != nil {
+			return true, nil, err
+		}
+		return true, obj, nil
+	})
+
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	policy := `apiVersion: tkspolicy.openinfradev.github.io/v1
+kind: TKSPolicy
+metadata:
+  name: p2
+  namespace: org
+spec:
+  template: k8srequiredlabels
+  clusters: [c1]
+  params:
+    labels: [owner]
+`
+	if err := os.WriteFile(file, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, out := newTestCLI(dc, nil)
+	if err := c.run([]string{"policies", "apply", "-f", file, "--force"}); err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if !strings.Contains(string(applied), `"name":"p2"`) || !strings.Contains(out.String(), "p2") {
+		t.Errorf("want p2 applied got (%s)\n%s", applied, out.String())
+	}
+
+	c, _ = newTestCLI(dc, nil)
+	c.in = strings.NewReader(strings.Replace(policy, "labels: [owner]", "labels: owner", 1))
+	if err := c.run([]string{"policies", "apply", "-f", "-"}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("want (%v) got (%v)", ErrInvalid, err)
+	}
+
+	c, _ = newTestCLI(dc, nil)
+	if err := c.run([]string{"policies", "apply", "-f", file, "-n", "other"}); !errors.Is(err, errUsage) {
+		t.Errorf("want (%v) got (%v)", errUsage, err)
+	}
+}
+
+func TestCLIDeletePolicy(t *testing.T) {
+	c, out := newTestCLI(newFakeDynamicClient(newCLIObjects()...), nil)
+	if err := c.run([]string{"policies", "delete", "p1", "-n", "org", "--wait", "0"}); err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if out.String() != "tkspolicy/p1 deleted\n" {
+		t.Errorf("unexpected output (%s)", out.String())
+	}
+}
+
+func TestCLIClusterHealth(t *testing.T) {
+	kubeconfig := `apiVersion: v1
+kind: Config
+clusters:
+- name: c1
+  cluster:
+    server: https://c1.example.com
+contexts:
+- name: c1
+  context:
+    cluster: c1
+    user: admin
+current-context: c1
+users:
+- name: admin
+  user:
+    token: secret
+`
+	adminClientSet := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "c1", Name: "c1-tks-kubeconfig"},
+		Data:       map[string][]byte{"value": []byte(kubeconfig)},
+	})
+	userClientSet := newHealthClientSet(newNode("node1", corev1.ConditionTrue))
+
+	c, out := newTestCLI(newFakeDynamicClient(), adminClientSet)
+	var host string
+	c.userClient = func(config *rest.Config) (kubernetes.Interface, error) {
+		host = config.Host
+		return userClientSet, nil
+	}
+	if err := c.run([]string{"cluster", "health", "c1"}); err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if host != "https://c1.example.com" {
+		t.Errorf("want user cluster config of c1 got (%s)", host)
+	}
+	for _, want := range []string{"v1.29.3", "node1", "COMPONENT"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("want %q in\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"syscall"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newFakeDynamicClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			TKSClusterGVR:        "TKSClusterList",
+			TKSPolicyTemplateGVR: "TKSPolicyTemplateList",
+			TKSPolicyGVR:         "TKSPolicyList",
+		}, objects...)
+}
+
+func newUnstructured(kind string, namespace string, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "tkspolicy.openinfradev.github.io/v1",
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"namespace": namespace,
+			"name":      name,
+		},
+		"spec": spec,
+	}}
+}
+
+func reactWithError(err error) k8stesting.ReactionFunc {
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, err
+	}
+}
+
+func TestGetTKSCluster(t *testing.T) {
+	dc := newFakeDynamicClient(newUnstructured("TKSCluster", "org", "c1",
+		map[string]interface{}{"clusterName": "c1", "context": "c1"}))
+
+	tkscluster, err := GetTKSCluster(dc, "org", "c1")
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if tkscluster.Spec.ClusterName != "c1" {
+		t.Errorf("want (%s) got (%s)", "c1", tkscluster.Spec.ClusterName)
+	}
+}
+
+func TestGetTKSClusterErrors(t *testing.T) {
+	gr := schema.GroupResource{Group: TKSClusterGVR.Group, Resource: TKSClusterGVR.Resource}
+	tests := []struct {
+		name    string
+		reactor error
+		want    error
+	}{
+		{"not found", apierrors.NewNotFound(gr, "c1"), ErrNotFound},
+		{"forbidden", apierrors.NewForbidden(gr, "c1", errors.New("rbac")), ErrForbidden},
+		{"unauthorized", apierrors.NewUnauthorized("token expired"), ErrForbidden},
+		{"unavailable", apierrors.NewServiceUnavailable("down"), ErrClusterUnreachable},
+		{"connection refused", &url.Error{Op: "Get", URL: "https://10.0.0.1:6443", Err: syscall.ECONNREFUSED}, ErrClusterUnreachable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dc := newFakeDynamicClient()
+			dc.PrependReactor("get", TKSClusterGVR.Resource, reactWithError(tt.reactor))
+
+			tkscluster, err := GetTKSCluster(dc, "org", "c1")
+			if tkscluster != nil {
+				t.Errorf("want nil cluster got (%+v)", tkscluster)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("want (%v) got (%v)", tt.want, err)
+			}
+			var resourceErr *ResourceError
+			if !errors.As(err, &resourceErr) || resourceErr.Name != "c1" || resourceErr.Namespace != "org" {
+				t.Errorf("want *ResourceError for org/c1 got (%#v)", err)
+			}
+		})
+	}
+}
+
+func TestGetTKSClusterKeepsAPIStatus(t *testing.T) {
+	gr := schema.GroupResource{Group: TKSClusterGVR.Group, Resource: TKSClusterGVR.Resource}
+	dc := newFakeDynamicClient()
+	dc.PrependReactor("get", TKSClusterGVR.Resource, reactWithError(apierrors.NewNotFound(gr, "c1")))
+
+	_, err := GetTKSCluster(dc, "org", "c1")
+	var statusErr *apierrors.StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("want *StatusError in chain got (%v)", err)
+	}
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("want apierrors.IsNotFound to match (%v)", err)
+	}
+}
+
+func TestListErrors(t *testing.T) {
+	gvrs := []schema.GroupVersionResource{TKSClusterGVR, TKSPolicyTemplateGVR, TKSPolicyGVR}
+	list := func(gvr schema.GroupVersionResource, dc *dynamicfake.FakeDynamicClient) (int, error) {
+		switch gvr {
+		case TKSClusterGVR:
+			items, err := GetTKSclusters(dc, "org")
+			return len(items), err
+		case TKSPolicyTemplateGVR:
+			items, err := GetTKSPolicyTemplates(dc, "org")
+			return len(items), err
+		default:
+			items, err := GetTKSPolicies(dc, "org")
+			return len(items), err
+		}
+	}
+
+	for _, gvr := range gvrs {
+		gr := schema.GroupResource{Group: gvr.Group, Resource: gvr.Resource}
+		tests := []struct {
+			name    string
+			reactor error
+			want    error
+		}{
+			{"forbidden", apierrors.NewForbidden(gr, "", errors.New("rbac")), ErrForbidden},
+			{"unreachable", &url.Error{Op: "Get", URL: "https://10.0.0.1:6443", Err: syscall.ECONNREFUSED}, ErrClusterUnreachable},
+			{"timeout", apierrors.NewTimeoutError("slow", 1), ErrClusterUnreachable},
+		}
+		for _, tt := range tests {
+			t.Run(gvr.Resource+"/"+tt.name, func(t *testing.T) {
+				dc := newFakeDynamicClient()
+				dc.PrependReactor("list", gvr.Resource, reactWithError(tt.reactor))
+
+				n, err := list(gvr, dc)
+				if !errors.Is(err, tt.want) {
+					t.Errorf("want (%v) got (%v)", tt.want, err)
+				}
+				if n != 0 {
+					t.Errorf("want no items got (%d)", n)
+				}
+			})
+		}
+	}
+}
+
+func TestListConversionErrors(t *testing.T) {
+	dc := newFakeDynamicClient(
+		newUnstructured("TKSCluster", "org", "c1", map[string]interface{}{"clusterName": int64(1)}),
+		newUnstructured("TKSPolicyTemplate", "org", "t1", map[string]interface{}{"clusters": "c1"}),
+		newUnstructured("TKSPolicy", "org", "p1", map[string]interface{}{"template": []interface{}{"t1"}}),
+	)
+
+	for _, test := range []struct {
+		resource string
+		get      func() error
+	}{
+		{TKSClusterGVR.Resource, func() error { _, err := GetTKSclusters(dc, "org"); return err }},
+		{TKSPolicyTemplateGVR.Resource, func() error { _, err := GetTKSPolicyTemplates(dc, "org"); return err }},
+		{TKSPolicyGVR.Resource, func() error { _, err := GetTKSPolicies(dc, "org"); return err }},
+		{TKSClusterGVR.Resource, func() error { _, err := GetTKSCluster(dc, "org", "c1"); return err }},
+	} {
+		err := test.get()
+		var resourceErr *ResourceError
+		if !errors.Is(err, ErrConversion) || !errors.As(err, &resourceErr) || resourceErr.Resource != test.resource {
+			t.Errorf("%s: want (%v) of the resource got (%v)", test.resource, ErrConversion, err)
+		}
+	}
+}
+
+func TestListDoesNotLeakFieldsBetweenItems(t *testing.T) {
+	c1 := newUnstructured("TKSCluster", "org", "c1", map[string]interface{}{"clusterName": "c1", "context": "ctx"})
+	c2 := newUnstructured("TKSCluster", "org", "c2", map[string]interface{}{"clusterName": "c2"})
+	dc := newFakeDynamicClient(c1, c2)
+
+	tksclusters, err := GetTKSclusters(dc, "org")
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if len(tksclusters) != 2 {
+		t.Fatalf("want 2 clusters got (%d)", len(tksclusters))
+	}
+	for _, c := range tksclusters {
+		if c.GetName() == "c2" && c.Spec.Context != "" {
+			t.Errorf("want empty context for c2 got (%s)", c.Spec.Context)
+		}
+	}
+}
+
+func TestGetUserClusterConfigErrors(t *testing.T) {
+	secret := func(data map[string][]byte) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "org", Name: "org-tks-kubeconfig"},
+			Data:       data,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		reactor error
+		want    error
+	}{
+		{"missing secret", nil, nil, ErrNotFound},
+		{"missing value", []runtime.Object{secret(map[string][]byte{})}, nil, ErrNotFound},
+		{"invalid kubeconfig", []runtime.Object{secret(map[string][]byte{"value": []byte("not: [a kubeconfig")})}, nil, ErrConversion},
+		{"forbidden", nil, apierrors.NewForbidden(corev1.Resource("secrets"), "org-tks-kubeconfig", errors.New("rbac")), ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientSet := fake.NewSimpleClientset(tt.objects...)
+			if tt.reactor != nil {
+				clientSet.PrependReactor("get", "secrets", reactWithError(tt.reactor))
+			}
+
+			config, err := GetUserClusterConfig(clientSet, "org")
+			if config != nil {
+				t.Errorf("want nil config got (%+v)", config)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("want (%v) got (%v)", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestGetUserClusterConfig(t *testing.T) {
+	kubeconfig := `apiVersion: v1
+kind: Config
+clusters:
+- name: c1
+  cluster:
+    server: https://10.0.0.1:6443
+contexts:
+- name: c1
+  context:
+    cluster: c1
+    user: admin
+current-context: c1
+users:
+- name: admin
+  user:
+    token: secret
+`
+	clientSet := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "org", Name: "org-tks-kubeconfig"},
+		Data:       map[string][]byte{"value": []byte(kubeconfig)},
+	})
+
+	config, err := GetUserClusterConfig(clientSet, "org")
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if config.Host != "https://10.0.0.1:6443" {
+		t.Errorf("want (%s) got (%s)", "https://10.0.0.1:6443", config.Host)
+	}
+}
+
+func TestGetKubernetesVersionUnreachable(t *testing.T) {
+	clientSet := fake.NewSimpleClientset()
+	clientSet.PrependReactor("get", "version", reactWithError(&url.Error{Op: "Get", URL: "https://10.0.0.1:6443/version", Err: syscall.ECONNREFUSED}))
+
+	version, err := GetKubernetesVersion(clientSet.Discovery())
+	if version != "" {
+		t.Errorf("want empty version got (%s)", version)
+	}
+	if !errors.Is(err, ErrClusterUnreachable) {
+		t.Errorf("want (%v) got (%v)", ErrClusterUnreachable, err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"slices"
+	"sort"
+
+	"k8s.io/client-go/dynamic"
+)
+
+// ConsistencyReport lists the TKS CRD objects of a namespace which don't reference each other correctly
+type ConsistencyReport struct {
+	Namespace            string             `json:"namespace"`
+	DanglingTemplates    []DanglingTemplate `json:"danglingTemplates"`
+	UnregisteredClusters []PolicyCluster    `json:"unregisteredClusters"`
+	UndeployedTemplates  []PolicyCluster    `json:"undeployedTemplates"`
+	UnusedTemplates      []string           `json:"unusedTemplates"`
+	Consistent           bool               `json:"consistent"`
+}
+
+// DanglingTemplate is a policy which references a TKSPolicyTemplate that doesn't exist
+type DanglingTemplate struct {
+	Policy   string `json:"policy"`
+	Template string `json:"template"`
+}
+
+// PolicyCluster is a cluster targeted by a policy
+type PolicyCluster struct {
+	Policy   string `json:"policy"`
+	Template string `json:"template"`
+	Cluster  string `json:"cluster"`
+}
+
+func CheckConsistency(dc dynamic.Interface, namespace string) (*ConsistencyReport, error) {
+	tksclusters, err := GetTKSclusters(dc, namespace)
+	if err != nil {
+		return nil, err
+	}
+	tksPolicyTemplates, err := GetTKSPolicyTemplates(dc, namespace)
+	if err != nil {
+		return nil, err
+	}
+	tksPolicies, err := GetTKSPolicies(dc, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	report := GetConsistencyReport(tksclusters, tksPolicyTemplates, tksPolicies)
+	report.Namespace = namespace
+	return report, nil
+}
+
+// GetConsistencyReport cross-checks TKSPolicies against TKSPolicyTemplates and TKSClusters:
+//   - policies whose Spec.Template is not an existing template
+//   - policies targeting clusters that are not registered as TKSCluster
+//   - policies targeting clusters the template is not deployed to (not in the template Spec.Clusters)
+//   - templates no policy uses
+func GetConsistencyReport(tksclusters []TKSCluster, tksPolicyTemplates []TKSPolicyTemplate, tksPolicies []TKSPolicy) *ConsistencyReport {
+	report := &ConsistencyReport{
+		DanglingTemplates:    []DanglingTemplate{},
+		UnregisteredClusters: []PolicyCluster{},
+		UndeployedTemplates:  []PolicyCluster{},
+		UnusedTemplates:      []string{},
+	}
+
+	clusters := make(map[string]bool, len(tksclusters))
+	for _, tkscluster := range tksclusters {
+		clusters[tkscluster.GetName()] = true
+	}
+	templates := make(map[string]*TKSPolicyTemplate, len(tksPolicyTemplates))
+	for i := range tksPolicyTemplates {
+		templates[tksPolicyTemplates[i].GetName()] = &tksPolicyTemplates[i]
+	}
+
+	used := make(map[string]bool)
+	for _, tksPolicy := range tksPolicies {
+		policy := tksPolicy.GetName()
+		template, ok := templates[tksPolicy.Spec.Template]
+		if !ok {
+			report.DanglingTemplates = append(report.DanglingTemplates,
+				DanglingTemplate{Policy: policy, Template: tksPolicy.Spec.Template})
+		} else {
+			used[tksPolicy.Spec.Template] = true
+		}
+
+		for _, cluster := range tksPolicy.Spec.Clusters {
+			pc := PolicyCluster{Policy: policy, Template: tksPolicy.Spec.Template, Cluster: cluster}
+			if !clusters[cluster] {
+				report.UnregisteredClusters = append(report.UnregisteredClusters, pc)
+			}
+			if ok && !slices.Contains(template.Spec.Clusters, cluster) {
+				report.UndeployedTemplates = append(report.UndeployedTemplates, pc)
+			}
+		}
+	}
+
+	for name := range templates {
+		if !used[name] {
+			report.UnusedTemplates = append(report.UnusedTemplates, name)
+		}
+	}
+	sort.Strings(report.UnusedTemplates)
+
+	report.Consistent = len(report.DanglingTemplates) == 0 && len(report.UnregisteredClusters) == 0 &&
+		len(report.UndeployedTemplates) == 0 && len(report.UnusedTemplates) == 0
+	return report
+}
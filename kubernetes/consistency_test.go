@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestCheckConsistency(t *testing.T) {
+	dc := newFakeDynamicClient(
+		newUnstructured("TKSCluster", "org", "c1", map[string]interface{}{"clusterName": "c1"}),
+		newUnstructured("TKSCluster", "org", "c2", map[string]interface{}{"clusterName": "c2"}),
+		newUnstructured("TKSPolicyTemplate", "org", "k8srequiredlabels", map[string]interface{}{
+			"clusters": []interface{}{"c1"},
+			"version":  "v1.0.0",
+		}),
+		newUnstructured("TKSPolicyTemplate", "org", "k8sallowedrepos", map[string]interface{}{
+			"clusters": []interface{}{"c1", "c2"},
+			"version":  "v1.0.0",
+		}),
+		newUnstructured("TKSPolicy", "org", "p1", map[string]interface{}{
+			"template": "k8srequiredlabels",
+			"clusters": []interface{}{"c1", "c2", "c3"},
+		}),
+		newUnstructured("TKSPolicy", "org", "p2", map[string]interface{}{
+			"template": "k8sdeleted",
+			"clusters": []interface{}{"c1"},
+		}),
+	)
+
+	report, err := CheckConsistency(dc, "org")
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+
+	if want := []DanglingTemplate{{Policy: "p2", Template: "k8sdeleted"}}; !reflect.DeepEqual(report.DanglingTemplates, want) {
+		t.Errorf("dangling: want (%v) got (%v)", want, report.DanglingTemplates)
+	}
+	if want := []PolicyCluster{{Policy: "p1", Template: "k8srequiredlabels", Cluster: "c3"}}; !reflect.DeepEqual(report.UnregisteredClusters, want) {
+		t.Errorf("unregistered: want (%v) got (%v)", want, report.UnregisteredClusters)
+	}
+	want := []PolicyCluster{
+		{Policy: "p1", Template: "k8srequiredlabels", Cluster: "c2"},
+		{Policy: "p1", Template: "k8srequiredlabels", Cluster: "c3"},
+	}
+	if !reflect.DeepEqual(report.UndeployedTemplates, want) {
+		t.Errorf("undeployed: want (%v) got (%v)", want, report.UndeployedTemplates)
+	}
+	if !reflect.DeepEqual(report.UnusedTemplates, []string{"k8sallowedrepos"}) {
+		t.Errorf("unused: want (%v) got (%v)", []string{"k8sallowedrepos"}, report.UnusedTemplates)
+	}
+	if report.Consistent || report.Namespace != "org" {
+		t.Errorf("unexpected report (%+v)", report)
+	}
+}
+
+func TestCheckConsistencyConsistent(t *testing.T) {
+	dc := newFakeDynamicClient(
+		newUnstructured("TKSCluster", "org", "c1", map[string]interface{}{"clusterName": "c1"}),
+		newUnstructured("TKSPolicyTemplate", "org", "t1", map[string]interface{}{"clusters": []interface{}{"c1"}}),
+		newUnstructured("TKSPolicy", "org", "p1", map[string]interface{}{"template": "t1", "clusters": []interface{}{"c1"}}),
+	)
+
+	report, err := CheckConsistency(dc, "org")
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if !report.Consistent {
+		t.Errorf("want consistent report got (%+v)", report)
+	}
+}
+
+func TestCheckConsistencyError(t *testing.T) {
+	gr := schema.GroupResource{Group: TKSPolicyGVR.Group, Resource: TKSPolicyGVR.Resource}
+	dc := newFakeDynamicClient()
+	dc.PrependReactor("list", TKSPolicyGVR.Resource, reactWithError(apierrors.NewForbidden(gr, "", errors.New("rbac"))))
+
+	if _, err := CheckConsistency(dc, "org"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("want (%v) got (%v)", ErrForbidden, err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+var (
+	ErrNotFound           = errors.New("resource not found")
+	ErrForbidden          = errors.New("access forbidden")
+	ErrConversion         = errors.New("failed to convert resource")
+	ErrClusterUnreachable = errors.New("cluster unreachable")
+	ErrAlreadyExists      = errors.New("resource already exists")
+	ErrConflict           = errors.New("resource version conflict")
+	ErrInvalid            = errors.New("invalid resource")
+)
+
+// ResourceError describes a failed call against a kubernetes resource.
+// Kind is one of the sentinel errors above (or nil when the failure does not fit any of them)
+// and Err is the original error, so both can be matched with errors.Is/As.
+type ResourceError struct {
+	Op        string
+	Resource  string
+	Namespace string
+	Name      string
+	Kind      error
+	Err       error
+}
+
+func (e *ResourceError) Error() string {
+	target := e.Resource
+	if e.Namespace != "" {
+		target = e.Namespace + "/" + target
+	}
+	if e.Name != "" {
+		target = target + "/" + e.Name
+	}
+	if e.Kind != nil {
+		return fmt.Sprintf("%s %s: %s - %s", e.Op, target, e.Kind, e.Err)
+	}
+	return fmt.Sprintf("%s %s: %s", e.Op, target, e.Err)
+}
+
+func (e *ResourceError) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+func newResourceError(op, resource, namespace, name string, err error) *ResourceError {
+	return &ResourceError{
+		Op:        op,
+		Resource:  resource,
+		Namespace: namespace,
+		Name:      name,
+		Kind:      classifyError(err),
+		Err:       err,
+	}
+}
+
+// classifyError maps an error returned by client-go to one of the sentinel errors.
+func classifyError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case apierrors.IsNotFound(err):
+		return ErrNotFound
+	case apierrors.IsForbidden(err), apierrors.IsUnauthorized(err):
+		return ErrForbidden
+	case apierrors.IsAlreadyExists(err):
+		return ErrAlreadyExists
+	case apierrors.IsConflict(err):
+		return ErrConflict
+	case apierrors.IsInvalid(err), apierrors.IsBadRequest(err):
+		return ErrInvalid
+	case apierrors.IsServiceUnavailable(err), apierrors.IsTimeout(err), apierrors.IsServerTimeout(err):
+		return ErrClusterUnreachable
+	}
+
+	var urlErr *url.Error
+	var netErr net.Error
+	if errors.As(err, &urlErr) || errors.As(err, &netErr) {
+		return ErrClusterUnreachable
+	}
+	return nil
+}
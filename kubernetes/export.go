@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+// exportKinds are exported in dependency order: templates before the policies which reference them
+var exportKinds = []struct {
+	Kind string
+	GVR  schema.GroupVersionResource
+}{
+	{"TKSPolicyTemplate", TKSPolicyTemplateGVR},
+	{"TKSCluster", TKSClusterGVR},
+	{"TKSPolicy", TKSPolicyGVR},
+}
+
+// metadata fields which are owned by the source cluster and can't be applied elsewhere
+var serverMetadataFields = []string{
+	"uid", "resourceVersion", "generation", "creationTimestamp", "deletionTimestamp",
+	"deletionGracePeriodSeconds", "managedFields", "selfLink", "ownerReferences",
+}
+
+const (
+	ImportActionCreate    = "create"
+	ImportActionUpdate    = "update"
+	ImportActionUnchanged = "unchanged"
+)
+
+type ImportOptions struct {
+	DryRun bool
+}
+
+// ImportResult is the outcome of importing one object.
+// Diff lists the changed fields against the object in the target namespace ("+" added, "-" removed, "~" changed).
+type ImportResult struct {
+	Kind   string   `json:"kind"`
+	Name   string   `json:"name"`
+	Action string   `json:"action" enums:"create,update,unchanged"`
+	Diff   []string `json:"diff,omitempty"`
+}
+
+// ExportTKSResources writes the TKSPolicyTemplates, TKSClusters and TKSPolicies of the namespace to w
+// as a multi-document YAML stream without status and server-populated metadata, ready to be applied.
+func ExportTKSResources(dc dynamic.Interface, namespace string, w io.Writer) error {
+	first := true
+	for _, k := range exportKinds {
+		resources, err := dc.Resource(k.GVR).Namespace(namespace).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return newResourceError("list", k.GVR.Resource, namespace, "", err)
+		}
+
+		items := resources.Items
+		sort.Slice(items, func(i, j int) bool { return items[i].GetName() < items[j].GetName() })
+		for i := range items {
+			obj := cleanForExport(&items[i])
+			out, err := yaml.Marshal(obj.Object)
+			if err != nil {
+				return &ResourceError{Op: "export", Resource: k.GVR.Resource, Namespace: namespace, Name: obj.GetName(),
+					Kind: ErrConversion, Err: err}
+			}
+
+			if !first {
+				if _, err := io.WriteString(w, "---\n"); err != nil {
+					return err
+				}
+			}
+			first = false
+			if _, err := w.Write(out); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ImportTKSResources creates or updates the objects of a YAML stream written by ExportTKSResources in namespace.
+// With DryRun nothing is written and the results only show what would change.
+func ImportTKSResources(dc dynamic.Interface, namespace string, r io.Reader, opts ImportOptions) ([]ImportResult, error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(r, 4096)
+
+	var results []ImportResult
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return results, &ResourceError{Op: "import", Namespace: namespace, Kind: ErrConversion, Err: err}
+		}
+		if len(raw) == 0 || string(raw) == "null" {
+			continue
+		}
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(raw); err != nil {
+			return results, &ResourceError{Op: "import", Namespace: namespace, Kind: ErrConversion, Err: err}
+		}
+
+		result, err := importTKSResource(dc, namespace, obj, opts)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func importTKSResource(dc dynamic.Interface, namespace string, obj *unstructured.Unstructured, opts ImportOptions) (ImportResult, error) {
+	result := ImportResult{Kind: obj.GetKind(), Name: obj.GetName()}
+
+	var gvr schema.GroupVersionResource
+	for _, k := range exportKinds {
+		if k.Kind == obj.GetKind() && k.GVR.GroupVersion().String() == obj.GetAPIVersion() {
+			gvr = k.GVR
+		}
+	}
+	if gvr.Empty() {
+		return result, &ResourceError{Op: "import", Resource: obj.GetKind(), Namespace: namespace, Name: obj.GetName(),
+			Kind: ErrInvalid, Err: fmt.Errorf("unsupported object %s %s", obj.GetAPIVersion(), obj.GetKind())}
+	}
+
+	obj = cleanForExport(obj)
+	obj.SetNamespace(namespace)
+	resourceClient := dc.Resource(gvr).Namespace(namespace)
+
+	existing, err := resourceClient.Get(context.TODO(), obj.GetName(), metav1.GetOptions{})
+	if err != nil {
+		if classifyError(err) != ErrNotFound {
+			return result, newResourceError("get", gvr.Resource, namespace, obj.GetName(), err)
+		}
+		result.Action = ImportActionCreate
+		result.Diff = diffObjects("", nil, obj.Object)
+		if opts.DryRun {
+			return result, nil
+		}
+		if _, err := resourceClient.Create(context.TODO(), obj, metav1.CreateOptions{}); err != nil {
+			return result, newResourceError("create", gvr.Resource, namespace, obj.GetName(), err)
+		}
+		return result, nil
+	}
+
+	result.Diff = diffObjects("", cleanForExport(existing).Object, obj.Object)
+	if len(result.Diff) == 0 {
+		result.Action = ImportActionUnchanged
+		return result, nil
+	}
+	result.Action = ImportActionUpdate
+	if opts.DryRun {
+		return result, nil
+	}
+
+	obj.SetResourceVersion(existing.GetResourceVersion())
+	if status, ok := existing.Object["status"]; ok {
+		obj.Object["status"] = status
+	}
+	if _, err := resourceClient.Update(context.TODO(), obj, metav1.UpdateOptions{}); err != nil {
+		return result, newResourceError("update", gvr.Resource, namespace, obj.GetName(), err)
+	}
+	return result, nil
+}
+
+// cleanForExport returns a copy of the object without status and server-populated metadata.
+func cleanForExport(u *unstructured.Unstructured) *unstructured.Unstructured {
+	obj := u.DeepCopy()
+	delete(obj.Object, "status")
+	for _, f := range serverMetadataFields {
+		unstructured.RemoveNestedField(obj.Object, "metadata", f)
+	}
+
+	annotations := obj.GetAnnotations()
+	delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+	if len(annotations) == 0 {
+		unstructured.RemoveNestedField(obj.Object, "metadata", "annotations")
+	} else {
+		obj.SetAnnotations(annotations)
+	}
+	return obj
+}
+
+// diffObjects returns the differences between two unstructured values as "+ path: new", "- path: old"
+// and "~ path: old -> new" lines sorted by path. Lists are compared as a whole.
+func diffObjects(path string, old, new interface{}) []string {
+	oldMap, oldIsMap := old.(map[string]interface{})
+	newMap, newIsMap := new.(map[string]interface{})
+
+	switch {
+	case old == nil && new == nil:
+		return nil
+	case old == nil && newIsMap:
+		oldMap, oldIsMap = map[string]interface{}{}, true
+	case new == nil && oldIsMap:
+		newMap, newIsMap = map[string]interface{}{}, true
+	}
+
+	if oldIsMap && newIsMap {
+		keys := make(map[string]bool)
+		for k := range oldMap {
+			keys[k] = true
+		}
+		for k := range newMap {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		var diff []string
+		for _, k := range sorted {
+			child := k
+			if path != "" {
+				child = path + "." + k
+			}
+			diff = append(diff, diffObjects(child, oldMap[k], newMap[k])...)
+		}
+		return diff
+	}
+
+	switch {
+	case old == nil:
+		return []string{fmt.Sprintf("+ %s: %s", path, diffValue(new))}
+	case new == nil:
+		return []string{fmt.Sprintf("- %s: %s", path, diffValue(old))}
+	case !reflect.DeepEqual(old, new):
+		return []string{fmt.Sprintf("~ %s: %s -> %s", path, diffValue(old), diffValue(new))}
+	}
+	return nil
+}
+
+func diffValue(v interface{}) string {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(out)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newExportedObjects() []*unstructured.Unstructured {
+	template := newUnstructured("TKSPolicyTemplate", "org", "k8srequiredlabels", map[string]interface{}{
+		"version":  "v1.0.0",
+		"clusters": []interface{}{"c1"},
+	})
+	policy := newUnstructured("TKSPolicy", "org", "p1", map[string]interface{}{
+		"template": "k8srequiredlabels",
+		"clusters": []interface{}{"c1"},
+	})
+	cluster := newUnstructured("TKSCluster", "org", "c1", map[string]interface{}{"clusterName": "c1"})
+
+	for _, u := range []*unstructured.Unstructured{template, policy, cluster} {
+		u.SetUID("4f2a1c7e-0000-0000-0000-000000000000")
+		u.SetResourceVersion("1234")
+		u.SetGeneration(3)
+		u.Object["metadata"].(map[string]interface{})["managedFields"] = []interface{}{
+			map[string]interface{}{"manager": "tks-policy-operator"},
+		}
+		u.SetAnnotations(map[string]string{
+			"kubectl.kubernetes.io/last-applied-configuration": "{}",
+			"tks/description": "exported",
+		})
+		u.Object["status"] = map[string]interface{}{"lastUpdate": "2024-01-01"}
+	}
+	return []*unstructured.Unstructured{template, policy, cluster}
+}
+
+func TestExportTKSResources(t *testing.T) {
+	objs := newExportedObjects()
+	dc := newFakeDynamicClient(objs[0], objs[1], objs[2])
+
+	var out bytes.Buffer
+	if err := ExportTKSResources(dc, "org", &out); err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	exported := out.String()
+
+	docs := strings.Split(exported, "---\n")
+	if len(docs) != 3 {
+		t.Fatalf("want 3 documents got (%d)\n%s", len(docs), exported)
+	}
+	for i, kind := range []string{"TKSPolicyTemplate", "TKSCluster", "TKSPolicy"} {
+		if !strings.Contains(docs[i], "kind: "+kind) {
+			t.Errorf("document %d: want kind %s got\n%s", i, kind, docs[i])
+		}
+	}
+	for _, unwanted := range []string{"status:", "managedFields", "uid:", "resourceVersion", "generation", "last-applied-configuration"} {
+		if strings.Contains(exported, unwanted) {
+			t.Errorf("exported yaml must not contain %s\n%s", unwanted, exported)
+		}
+	}
+	if !strings.Contains(exported, "tks/description: exported") {
+		t.Errorf("exported yaml must keep annotations\n%s", exported)
+	}
+}
+
+func TestImportTKSResources(t *testing.T) {
+	objs := newExportedObjects()
+	source := newFakeDynamicClient(objs[0], objs[1], objs[2])
+	var out bytes.Buffer
+	if err := ExportTKSResources(source, "org", &out); err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	exported := out.String()
+
+	existing := newUnstructured("TKSPolicyTemplate", "org2", "k8srequiredlabels", map[string]interface{}{
+		"version":  "v0.9.0",
+		"clusters": []interface{}{"c1"},
+	})
+	existing.SetAnnotations(map[string]string{"tks/description": "exported"})
+	target := newFakeDynamicClient(existing)
+
+	results, err := ImportTKSResources(target, "org2", strings.NewReader(exported), ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	want := []ImportResult{
+		{Kind: "TKSPolicyTemplate", Name: "k8srequiredlabels", Action: ImportActionUpdate,
+			Diff: []string{`~ spec.version: "v0.9.0" -> "v1.0.0"`}},
+		{Kind: "TKSCluster", Name: "c1", Action: ImportActionCreate},
+		{Kind: "TKSPolicy", Name: "p1", Action: ImportActionCreate},
+	}
+	for i := range results {
+		if results[i].Action == ImportActionCreate {
+			if !slicesContainsPrefix(results[i].Diff, "+ metadata.namespace") {
+				t.Errorf("create diff must show the new namespace (%v)", results[i].Diff)
+			}
+			results[i].Diff = nil
+		}
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("want (%+v) got (%+v)", want, results)
+	}
+	for _, action := range target.Actions() {
+		if action.GetVerb() != "get" {
+			t.Errorf("dry run must not write, got (%s)", action.GetVerb())
+		}
+	}
+
+	if _, err := ImportTKSResources(target, "org2", strings.NewReader(exported), ImportOptions{}); err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	tksPolicyTemplate, err := GetTKSPolicyTemplate(target, "org2", "k8srequiredlabels")
+	if err != nil || tksPolicyTemplate.Spec.Version != "v1.0.0" {
+		t.Errorf("want imported template v1.0.0 got (%v, %v)", tksPolicyTemplate, err)
+	}
+	if _, err := GetTKSPolicy(target, "org2", "p1"); err != nil {
+		t.Errorf("want imported policy got (%v)", err)
+	}
+
+	results, err = ImportTKSResources(target, "org2", strings.NewReader(exported), ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	for _, result := range results {
+		if result.Action != ImportActionUnchanged {
+			t.Errorf("want unchanged after import got (%+v)", result)
+		}
+	}
+}
+
+func TestImportTKSResourcesUnsupported(t *testing.T) {
+	in := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\n"
+	if _, err := ImportTKSResources(newFakeDynamicClient(), "org", strings.NewReader(in), ImportOptions{}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("want (%v) got (%v)", ErrInvalid, err)
+	}
+}
+
+func slicesContainsPrefix(s []string, prefix string) bool {
+	for _, v := range s {
+		if strings.HasPrefix(v, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ClusterHealthReport is the health of a user cluster
+type ClusterHealthReport struct {
+	ServerVersion  string            `json:"serverVersion"`
+	APILatencyMs   int64             `json:"apiLatencyMs"`
+	Healthy        bool              `json:"healthy"`
+	Nodes          []NodeHealth      `json:"nodes"`
+	ControlPlane   []ComponentHealth `json:"controlPlane"`
+	KubeSystemPods []PodHealth       `json:"kubeSystemPods"`
+	CheckedAt      time.Time         `json:"checkedAt"`
+}
+
+type NodeHealth struct {
+	Name           string          `json:"name"`
+	Ready          bool            `json:"ready"`
+	KubeletVersion string          `json:"kubeletVersion,omitempty"`
+	Conditions     []NodeCondition `json:"conditions,omitempty"`
+}
+
+type NodeCondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// ComponentHealth is the health of a control-plane component (kube-apiserver, etcd, ...).
+// Pods counts the static pods found for the component and Ready the ones which are ready.
+type ComponentHealth struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Pods    int    `json:"pods"`
+	Ready   int    `json:"ready"`
+}
+
+type PodHealth struct {
+	Name     string `json:"name"`
+	Phase    string `json:"phase"`
+	Ready    bool   `json:"ready"`
+	Restarts int32  `json:"restarts"`
+	NodeName string `json:"nodeName,omitempty"`
+}
+
+// GetClusterHealth collects server version, API latency, node readiness, control-plane components and
+// kube-system pod status of the cluster.
+// Control-plane components are read from the kube-system pods labeled tier=control-plane (kubeadm static pods),
+// so the list is empty for managed clusters which don't expose them.
+func GetClusterHealth(clientSet kubernetes.Interface) (*ClusterHealthReport, error) {
+	report := &ClusterHealthReport{
+		Healthy:   true,
+		CheckedAt: time.Now(),
+	}
+
+	start := time.Now()
+	version, err := GetKubernetesVersion(clientSet.Discovery())
+	if err != nil {
+		return nil, err
+	}
+	report.ServerVersion = version
+	report.APILatencyMs = time.Since(start).Milliseconds()
+
+	nodes, err := clientSet.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, newResourceError("list", "nodes", "", "", err)
+	}
+	report.Nodes = make([]NodeHealth, 0, len(nodes.Items))
+	for _, node := range nodes.Items {
+		nh := getNodeHealth(node)
+		if !nh.Ready {
+			report.Healthy = false
+		}
+		report.Nodes = append(report.Nodes, nh)
+	}
+
+	pods, err := clientSet.CoreV1().Pods("kube-system").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, newResourceError("list", "pods", "kube-system", "", err)
+	}
+	components := make(map[string]*ComponentHealth)
+	report.KubeSystemPods = make([]PodHealth, 0, len(pods.Items))
+	for _, pod := range pods.Items {
+		ph := getPodHealth(pod)
+		if !ph.Ready && pod.Status.Phase != corev1.PodSucceeded {
+			report.Healthy = false
+		}
+		report.KubeSystemPods = append(report.KubeSystemPods, ph)
+
+		if pod.Labels["tier"] != "control-plane" {
+			continue
+		}
+		name := pod.Labels["component"]
+		if name == "" {
+			name = pod.Name
+		}
+		component, ok := components[name]
+		if !ok {
+			component = &ComponentHealth{Name: name}
+			components[name] = component
+		}
+		component.Pods++
+		if ph.Ready {
+			component.Ready++
+		}
+	}
+
+	report.ControlPlane = make([]ComponentHealth, 0, len(components))
+	for _, component := range components {
+		component.Healthy = component.Ready > 0
+		if !component.Healthy {
+			report.Healthy = false
+		}
+		report.ControlPlane = append(report.ControlPlane, *component)
+	}
+	sort.Slice(report.ControlPlane, func(i, j int) bool {
+		return report.ControlPlane[i].Name < report.ControlPlane[j].Name
+	})
+
+	return report, nil
+}
+
+func getNodeHealth(node corev1.Node) NodeHealth {
+	nh := NodeHealth{
+		Name:           node.Name,
+		KubeletVersion: node.Status.NodeInfo.KubeletVersion,
+	}
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady && c.Status == corev1.ConditionTrue {
+			nh.Ready = true
+		}
+		nh.Conditions = append(nh.Conditions, NodeCondition{
+			Type:    string(c.Type),
+			Status:  string(c.Status),
+			Reason:  c.Reason,
+			Message: c.Message,
+		})
+	}
+	return nh
+}
+
+func getPodHealth(pod corev1.Pod) PodHealth {
+	ph := PodHealth{
+		Name:     pod.Name,
+		Phase:    string(pod.Status.Phase),
+		NodeName: pod.Spec.NodeName,
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady && c.Status == corev1.ConditionTrue {
+			ph.Ready = true
+		}
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		ph.Restarts += cs.RestartCount
+	}
+	return ph
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newNode(name string, ready corev1.ConditionStatus) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{
+			NodeInfo: corev1.NodeSystemInfo{KubeletVersion: "v1.29.3"},
+			Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: ready, Reason: "KubeletReady"},
+				{Type: corev1.NodeMemoryPressure, Status: corev1.ConditionFalse},
+			},
+		},
+	}
+}
+
+func newKubeSystemPod(name string, labels map[string]string, ready corev1.ConditionStatus) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: name, Labels: labels},
+		Spec:       corev1.PodSpec{NodeName: "node1"},
+		Status: corev1.PodStatus{
+			Phase:             corev1.PodRunning,
+			Conditions:        []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}},
+			ContainerStatuses: []corev1.ContainerStatus{{Name: name, RestartCount: 2}},
+		},
+	}
+}
+
+func newHealthClientSet(objects ...runtime.Object) *fake.Clientset {
+	clientSet := fake.NewSimpleClientset(objects...)
+	clientSet.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.29.3"}
+	return clientSet
+}
+
+func TestGetClusterHealth(t *testing.T) {
+	clientSet := newHealthClientSet(
+		newNode("node1", corev1.ConditionTrue),
+		newKubeSystemPod("kube-apiserver-node1", map[string]string{"tier": "control-plane", "component": "kube-apiserver"}, corev1.ConditionTrue),
+		newKubeSystemPod("etcd-node1", map[string]string{"tier": "control-plane", "component": "etcd"}, corev1.ConditionTrue),
+		newKubeSystemPod("coredns-1", map[string]string{"k8s-app": "kube-dns"}, corev1.ConditionTrue),
+	)
+
+	report, err := GetClusterHealth(clientSet)
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if report.ServerVersion != "v1.29.3" {
+		t.Errorf("want (%s) got (%s)", "v1.29.3", report.ServerVersion)
+	}
+	if !report.Healthy {
+		t.Errorf("want healthy report got (%+v)", report)
+	}
+	if len(report.Nodes) != 1 || !report.Nodes[0].Ready || len(report.Nodes[0].Conditions) != 2 {
+		t.Errorf("want one ready node with 2 conditions got (%+v)", report.Nodes)
+	}
+	if len(report.ControlPlane) != 2 || report.ControlPlane[0].Name != "etcd" || report.ControlPlane[1].Name != "kube-apiserver" {
+		t.Errorf("want etcd and kube-apiserver components got (%+v)", report.ControlPlane)
+	}
+	if len(report.KubeSystemPods) != 3 || report.KubeSystemPods[0].Restarts != 2 {
+		t.Errorf("want 3 kube-system pods with restarts got (%+v)", report.KubeSystemPods)
+	}
+
+	if _, err := json.Marshal(report); err != nil {
+		t.Errorf("report is not JSON serialisable - %s", err)
+	}
+}
+
+func TestGetClusterHealthUnhealthy(t *testing.T) {
+	clientSet := newHealthClientSet(
+		newNode("node1", corev1.ConditionTrue),
+		newNode("node2", corev1.ConditionFalse),
+		newKubeSystemPod("kube-scheduler-node1", map[string]string{"tier": "control-plane", "component": "kube-scheduler"}, corev1.ConditionFalse),
+	)
+
+	report, err := GetClusterHealth(clientSet)
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if report.Healthy {
+		t.Errorf("want unhealthy report got (%+v)", report)
+	}
+	if report.ControlPlane[0].Healthy {
+		t.Errorf("want unhealthy kube-scheduler got (%+v)", report.ControlPlane[0])
+	}
+}
+
+func TestGetClusterHealthErrors(t *testing.T) {
+	clientSet := newHealthClientSet()
+	clientSet.PrependReactor("list", "nodes",
+		reactWithError(apierrors.NewForbidden(corev1.Resource("nodes"), "", errors.New("rbac"))))
+
+	report, err := GetClusterHealth(clientSet)
+	if report != nil {
+		t.Errorf("want nil report got (%+v)", report)
+	}
+	if !errors.Is(err, ErrForbidden) {
+		t.Errorf("want (%v) got (%v)", ErrForbidden, err)
+	}
+}
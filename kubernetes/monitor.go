@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	ProxyIssueStale    = "stale"
+	ProxyIssueMissing  = "missing"
+	ProxyIssueReplicas = "replicas"
+	ProxyIssueImage    = "image"
+	ProxyIssueError    = "error"
+)
+
+// MonitorOptions configures the TKSProxy monitor.
+// ExpectedVersion is compared with the image tag of the controller manager and audit deployments (skipped when empty)
+// and a status check older than StaleAfter is reported as stale (skipped when zero).
+type MonitorOptions struct {
+	ExpectedVersion string
+	StaleAfter      time.Duration
+}
+
+type ProxyIssue struct {
+	Type      string `json:"type" enums:"stale,missing,replicas,image,error"`
+	Component string `json:"component,omitempty"`
+	Message   string `json:"message"`
+}
+
+type ClusterProxyStatus struct {
+	Cluster             string       `json:"cluster"`
+	Status              string       `json:"status"`
+	ProxyStatus         string       `json:"proxyStatus"`
+	LastStatusCheckTime time.Time    `json:"lastStatusCheckTime"`
+	Healthy             bool         `json:"healthy"`
+	Issues              []ProxyIssue `json:"issues,omitempty"`
+}
+
+// ProxySummary is the TKSProxy status of every TKSCluster of an organization
+type ProxySummary struct {
+	Organization      string               `json:"organization"`
+	CheckedAt         time.Time            `json:"checkedAt"`
+	TotalClusters     int                  `json:"totalClusters"`
+	HealthyClusters   int                  `json:"healthyClusters"`
+	UnhealthyClusters int                  `json:"unhealthyClusters"`
+	IssueCounts       map[string]int       `json:"issueCounts"`
+	Clusters          []ClusterProxyStatus `json:"clusters"`
+}
+
+// MonitorTKSProxy evaluates the TKSClusters of each organization.
+// The organization id is the namespace the TKSClusters live in on the admin cluster.
+func MonitorTKSProxy(dc dynamic.Interface, organizations []string, opts MonitorOptions) ([]ProxySummary, error) {
+	now := time.Now()
+
+	summaries := make([]ProxySummary, 0, len(organizations))
+	for _, organization := range organizations {
+		tksclusters, err := GetTKSclusters(dc, organization)
+		if err != nil {
+			return nil, fmt.Errorf("monitor tksproxy of %s: %w", organization, err)
+		}
+		summaries = append(summaries, SummarizeTKSProxy(organization, tksclusters, opts, now))
+	}
+	return summaries, nil
+}
+
+func SummarizeTKSProxy(organization string, tksclusters []TKSCluster, opts MonitorOptions, now time.Time) ProxySummary {
+	summary := ProxySummary{
+		Organization: organization,
+		CheckedAt:    now,
+		IssueCounts:  make(map[string]int),
+		Clusters:     make([]ClusterProxyStatus, 0, len(tksclusters)),
+	}
+	for _, tkscluster := range tksclusters {
+		status := EvaluateTKSProxy(tkscluster, opts, now)
+		summary.TotalClusters++
+		if status.Healthy {
+			summary.HealthyClusters++
+		} else {
+			summary.UnhealthyClusters++
+		}
+		for _, issue := range status.Issues {
+			summary.IssueCounts[issue.Type]++
+		}
+		summary.Clusters = append(summary.Clusters, status)
+	}
+	return summary
+}
+
+func EvaluateTKSProxy(tkscluster TKSCluster, opts MonitorOptions, now time.Time) ClusterProxyStatus {
+	proxy := tkscluster.Status.TKSProxy
+	status := ClusterProxyStatus{
+		Cluster:     tkscluster.GetName(),
+		Status:      tkscluster.Status.Status,
+		ProxyStatus: proxy.Status,
+	}
+	if tkscluster.Status.LastStatusCheckTime > 0 {
+		status.LastStatusCheckTime = time.Unix(tkscluster.Status.LastStatusCheckTime, 0)
+	}
+
+	if tkscluster.Status.Status == "error" {
+		status.Issues = append(status.Issues, ProxyIssue{Type: ProxyIssueError,
+			Message: fmt.Sprintf("tkscluster is in error state: %s", tkscluster.Status.Error)})
+	}
+	if proxy.Status == "error" {
+		status.Issues = append(status.Issues, ProxyIssue{Type: ProxyIssueError, Message: "tksproxy is in error state"})
+	}
+
+	if opts.StaleAfter > 0 {
+		if status.LastStatusCheckTime.IsZero() {
+			status.Issues = append(status.Issues, ProxyIssue{Type: ProxyIssueStale, Message: "status has never been checked"})
+		} else if age := now.Sub(status.LastStatusCheckTime); age > opts.StaleAfter {
+			status.Issues = append(status.Issues, ProxyIssue{Type: ProxyIssueStale,
+				Message: fmt.Sprintf("last status check was %s ago", age.Truncate(time.Second))})
+		}
+	}
+
+	status.Issues = append(status.Issues, evaluateDeployment("controllerManager", proxy.ControllerManager, opts)...)
+	status.Issues = append(status.Issues, evaluateDeployment("audit", proxy.Audit, opts)...)
+
+	status.Healthy = len(status.Issues) == 0
+	return status
+}
+
+func evaluateDeployment(component string, deployment *DeploymentInfo, opts MonitorOptions) []ProxyIssue {
+	if deployment == nil {
+		return []ProxyIssue{{Type: ProxyIssueMissing, Component: component, Message: "deployment info is missing"}}
+	}
+
+	var issues []ProxyIssue
+	if deployment.NumReplicas < deployment.TotalReplicas {
+		issues = append(issues, ProxyIssue{Type: ProxyIssueReplicas, Component: component,
+			Message: fmt.Sprintf("%d of %d replicas available", deployment.NumReplicas, deployment.TotalReplicas)})
+	}
+	if opts.ExpectedVersion != "" {
+		if version := imageVersion(deployment.Image); version != opts.ExpectedVersion {
+			issues = append(issues, ProxyIssue{Type: ProxyIssueImage, Component: component,
+				Message: fmt.Sprintf("image %s, expected version %s", deployment.Image, opts.ExpectedVersion)})
+		}
+	}
+	return issues
+}
+
+// imageVersion returns the tag of an image reference, ignoring the digest and registry port.
+func imageVersion(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i+1:], "/") {
+		return ""
+	}
+	return image[i+1:]
+}
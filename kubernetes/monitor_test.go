@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func newTKSClusterWithStatus(namespace string, name string, status map[string]interface{}) *unstructured.Unstructured {
+	u := newUnstructured("TKSCluster", namespace, name, map[string]interface{}{"clusterName": name, "context": name})
+	u.Object["status"] = status
+	return u
+}
+
+func healthyProxyStatus(checkTime int64) map[string]interface{} {
+	deployment := func() map[string]interface{} {
+		return map[string]interface{}{
+			"image":         "harbor.example.com/tks/policy-manager:v1.2.0",
+			"totalReplicas": int64(2),
+			"numReplicas":   int64(2),
+		}
+	}
+	return map[string]interface{}{
+		"status":              "running",
+		"laststatuschecktime": checkTime,
+		"tksproxy": map[string]interface{}{
+			"status":            "ready",
+			"controllerManager": deployment(),
+			"audit":             deployment(),
+		},
+	}
+}
+
+func TestEvaluateTKSProxy(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	opts := MonitorOptions{ExpectedVersion: "v1.2.0", StaleAfter: 5 * time.Minute}
+
+	tests := []struct {
+		name   string
+		modify func(c *TKSCluster)
+		want   []string
+	}{
+		{"healthy", func(c *TKSCluster) {}, nil},
+		{"stale", func(c *TKSCluster) { c.Status.LastStatusCheckTime = now.Add(-time.Hour).Unix() }, []string{ProxyIssueStale}},
+		{"never checked", func(c *TKSCluster) { c.Status.LastStatusCheckTime = 0 }, []string{ProxyIssueStale}},
+		{"replicas", func(c *TKSCluster) { c.Status.TKSProxy.Audit.NumReplicas = 1 }, []string{ProxyIssueReplicas}},
+		{"image", func(c *TKSCluster) {
+			c.Status.TKSProxy.ControllerManager.Image = "harbor.example.com/tks/policy-manager:v1.1.0"
+		}, []string{ProxyIssueImage}},
+		{"missing", func(c *TKSCluster) { c.Status.TKSProxy.Audit = nil }, []string{ProxyIssueMissing}},
+		{"error", func(c *TKSCluster) {
+			c.Status.Status = "error"
+			c.Status.TKSProxy.Status = "error"
+		}, []string{ProxyIssueError, ProxyIssueError}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tkscluster, err := GetTKSCluster(newFakeDynamicClient(
+				newTKSClusterWithStatus("org", "c1", healthyProxyStatus(now.Add(-time.Minute).Unix()))), "org", "c1")
+			if err != nil {
+				t.Fatalf("unexpected error - %s", err)
+			}
+			tt.modify(tkscluster)
+
+			status := EvaluateTKSProxy(*tkscluster, opts, now)
+			if len(status.Issues) != len(tt.want) {
+				t.Fatalf("want (%v) got (%+v)", tt.want, status.Issues)
+			}
+			for i, issue := range status.Issues {
+				if issue.Type != tt.want[i] {
+					t.Errorf("want (%s) got (%s)", tt.want[i], issue.Type)
+				}
+			}
+			if status.Healthy != (len(tt.want) == 0) {
+				t.Errorf("want healthy (%t) got (%t)", len(tt.want) == 0, status.Healthy)
+			}
+		})
+	}
+}
+
+func TestImageVersion(t *testing.T) {
+	data := map[string]string{
+		"policy-manager:v1.2.0":                          "v1.2.0",
+		"harbor.example.com:5000/tks/policy-manager":     "",
+		"harbor.example.com:5000/tks/policy-manager:1.0": "1.0",
+		"policy-manager:v1.2.0@sha256:abcdef":            "v1.2.0",
+	}
+	for image, want := range data {
+		if got := imageVersion(image); got != want {
+			t.Errorf("%s: want (%s) got (%s)", image, want, got)
+		}
+	}
+}
+
+func TestMonitorTKSProxy(t *testing.T) {
+	now := time.Now().Unix()
+	unhealthy := healthyProxyStatus(now)
+	unhealthy["tksproxy"].(map[string]interface{})["audit"].(map[string]interface{})["numReplicas"] = int64(0)
+	dc := newFakeDynamicClient(
+		newTKSClusterWithStatus("org1", "c1", healthyProxyStatus(now)),
+		newTKSClusterWithStatus("org1", "c2", unhealthy),
+		newTKSClusterWithStatus("org2", "c3", healthyProxyStatus(now)),
+	)
+
+	summaries, err := MonitorTKSProxy(dc, []string{"org1", "org2"}, MonitorOptions{StaleAfter: time.Hour})
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if len(summaries) != 2 {
+		t.Fatalf("want 2 summaries got (%d)", len(summaries))
+	}
+	if s := summaries[0]; s.TotalClusters != 2 || s.HealthyClusters != 1 || s.UnhealthyClusters != 1 || s.IssueCounts[ProxyIssueReplicas] != 1 {
+		t.Errorf("unexpected org1 summary (%+v)", s)
+	}
+	if s := summaries[1]; s.TotalClusters != 1 || s.HealthyClusters != 1 {
+		t.Errorf("unexpected org2 summary (%+v)", s)
+	}
+}
+
+func TestMonitorTKSProxyError(t *testing.T) {
+	gr := schema.GroupResource{Group: TKSClusterGVR.Group, Resource: TKSClusterGVR.Resource}
+	dc := newFakeDynamicClient()
+	dc.PrependReactor("list", TKSClusterGVR.Resource, reactWithError(apierrors.NewForbidden(gr, "", errors.New("rbac"))))
+
+	if _, err := MonitorTKSProxy(dc, []string{"org1"}, MonitorOptions{}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("want (%v) got (%v)", ErrForbidden, err)
+	}
+}
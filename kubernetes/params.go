@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/dynamic"
+)
+
+// CheckTKSPolicyParams validates the params of a policy against the schema of the template it references
+// (Spec.Template, in the same namespace). The returned error matches ErrInvalid when the params don't fit the schema,
+// use ValidateTKSPolicyParams to get the field errors.
+func CheckTKSPolicyParams(dc dynamic.Interface, namespace string, tksPolicy *TKSPolicy) error {
+	tksPolicyTemplate, err := GetTKSPolicyTemplate(dc, namespace, tksPolicy.Spec.Template)
+	if err != nil {
+		return err
+	}
+
+	if errs := ValidateTKSPolicyParams(tksPolicy, tksPolicyTemplate); len(errs) > 0 {
+		return &ResourceError{Op: "validate", Resource: TKSPolicyGVR.Resource, Namespace: namespace, Name: tksPolicy.Name,
+			Kind: ErrInvalid, Err: errs.ToAggregate()}
+	}
+	return nil
+}
+
+// ValidateTKSPolicyParams validates Spec.Params against Spec.CRD.Spec.Validation.OpenAPIV3Schema of the template
+// with the same schema validator the kubernetes api server uses for custom resources.
+// Missing params are validated as an empty object so required parameters are reported.
+func ValidateTKSPolicyParams(tksPolicy *TKSPolicy, tksPolicyTemplate *TKSPolicyTemplate) field.ErrorList {
+	paramsPath := field.NewPath("spec", "params")
+
+	var params interface{} = map[string]interface{}{}
+	if tksPolicy.Spec.Params != nil && len(tksPolicy.Spec.Params.Raw) > 0 {
+		if err := json.Unmarshal(tksPolicy.Spec.Params.Raw, &params); err != nil {
+			return field.ErrorList{field.Invalid(paramsPath, string(tksPolicy.Spec.Params.Raw), "must be valid JSON")}
+		}
+	}
+
+	crdValidation := tksPolicyTemplate.Spec.CRD.Spec.Validation
+	if crdValidation == nil || crdValidation.OpenAPIV3Schema == nil {
+		// the template takes no parameters
+		if m, ok := params.(map[string]interface{}); ok && len(m) == 0 {
+			return nil
+		}
+		return field.ErrorList{field.Forbidden(paramsPath,
+			"template "+tksPolicyTemplate.GetName()+" does not define a parameter schema")}
+	}
+
+	var schema apiextensions.JSONSchemaProps
+	err := apiextensionsv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(crdValidation.OpenAPIV3Schema, &schema, nil)
+	if err != nil {
+		return field.ErrorList{field.InternalError(paramsPath, err)}
+	}
+	validator, _, err := validation.NewSchemaValidator(&schema)
+	if err != nil {
+		return field.ErrorList{field.InternalError(paramsPath, err)}
+	}
+
+	return validation.ValidateCustomResource(paramsPath, params, validator)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+func newParamsTemplate() *TKSPolicyTemplate {
+	tksPolicyTemplate := &TKSPolicyTemplate{}
+	tksPolicyTemplate.Name = "k8srequiredlabels"
+	tksPolicyTemplate.Spec.CRD.Spec.Validation = &Validation{
+		OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+			Type:     "object",
+			Required: []string{"labels"},
+			Properties: map[string]apiextensionsv1.JSONSchemaProps{
+				"message": {Type: "string"},
+				"mode": {Type: "string", Enum: []apiextensionsv1.JSON{
+					{Raw: []byte(`"strict"`)}, {Raw: []byte(`"loose"`)},
+				}},
+				"labels": {
+					Type: "array",
+					Items: &apiextensionsv1.JSONSchemaPropsOrArray{Schema: &apiextensionsv1.JSONSchemaProps{
+						Type:     "object",
+						Required: []string{"key"},
+						Properties: map[string]apiextensionsv1.JSONSchemaProps{
+							"key":          {Type: "string"},
+							"allowedRegex": {Type: "string", Pattern: "^[a-z]+$"},
+						},
+					}},
+				},
+			},
+		},
+	}
+	return tksPolicyTemplate
+}
+
+func TestValidateTKSPolicyParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		params string
+		want   []string
+	}{
+		{"valid", `{"labels":[{"key":"owner","allowedRegex":"abc"}],"mode":"strict"}`, nil},
+		{"missing required", `{"message":"hi"}`, []string{"spec.params.labels"}},
+		{"no params", ``, []string{"spec.params.labels"}},
+		{"type", `{"labels":[{"key":1}]}`, []string{"spec.params.labels[0].key"}},
+		{"nested required", `{"labels":[{"allowedRegex":"abc"}]}`, []string{"spec.params.labels[0].key"}},
+		{"enum", `{"labels":[],"mode":"none"}`, []string{"spec.params.mode"}},
+		{"pattern", `{"labels":[{"key":"a","allowedRegex":"ABC"}]}`, []string{"spec.params.labels[0].allowedRegex"}},
+		{"array", `{"labels":{"key":"owner"}}`, []string{"spec.params.labels"}},
+		{"invalid json", `{"labels":`, []string{"spec.params"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tksPolicy := newTKSPolicy("p1")
+			tksPolicy.Spec.Params = &apiextensionsv1.JSON{Raw: []byte(tt.params)}
+
+			errs := ValidateTKSPolicyParams(tksPolicy, newParamsTemplate())
+			if len(errs) != len(tt.want) {
+				t.Fatalf("want errors on (%v) got (%v)", tt.want, errs)
+			}
+			for i, err := range errs {
+				if err.Field != tt.want[i] {
+					t.Errorf("want (%s) got (%s)", tt.want[i], err.Field)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateTKSPolicyParamsWithoutSchema(t *testing.T) {
+	tksPolicyTemplate := &TKSPolicyTemplate{}
+	tksPolicy := newTKSPolicy("p1")
+
+	if errs := ValidateTKSPolicyParams(tksPolicy, tksPolicyTemplate); len(errs) != 1 || errs[0].Field != "spec.params" {
+		t.Errorf("want error on spec.params got (%v)", errs)
+	}
+
+	tksPolicy.Spec.Params = nil
+	if errs := ValidateTKSPolicyParams(tksPolicy, tksPolicyTemplate); len(errs) != 0 {
+		t.Errorf("want no error got (%v)", errs)
+	}
+}
+
+func TestCheckTKSPolicyParams(t *testing.T) {
+	dc := newFakeDynamicClient(newUnstructured("TKSPolicyTemplate", "org", "k8srequiredlabels", map[string]interface{}{
+		"version": "v1.0.0",
+		"crd": map[string]interface{}{"spec": map[string]interface{}{"validation": map[string]interface{}{
+			"openAPIV3Schema": map[string]interface{}{
+				"type":     "object",
+				"required": []interface{}{"labels"},
+				"properties": map[string]interface{}{
+					"labels": map[string]interface{}{"type": "array"},
+				},
+			},
+		}}},
+	}))
+
+	tksPolicy := newTKSPolicy("p1")
+	if err := CheckTKSPolicyParams(dc, "org", tksPolicy); err != nil {
+		t.Errorf("unexpected error - %s", err)
+	}
+
+	tksPolicy.Spec.Params = &apiextensionsv1.JSON{Raw: []byte(`{}`)}
+	if err := CheckTKSPolicyParams(dc, "org", tksPolicy); !errors.Is(err, ErrInvalid) {
+		t.Errorf("want (%v) got (%v)", ErrInvalid, err)
+	}
+
+	tksPolicy.Spec.Template = "unknown"
+	if err := CheckTKSPolicyParams(dc, "org", tksPolicy); !errors.Is(err, ErrNotFound) {
+		t.Errorf("want (%v) got (%v)", ErrNotFound, err)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+)
+
+const TKSPolicyFieldManager = "tks-policy-client"
+
+var enforcementActions = []string{"deny", "warn", "dryrun"}
+
+// DeleteOptions configures how long DeleteTKSPolicy waits for the policy to be removed from its clusters.
+// A zero Timeout returns right after the delete request.
+type DeleteOptions struct {
+	Timeout  time.Duration
+	Interval time.Duration
+}
+
+// ValidateTKSPolicy checks the fields of a TKSPolicy before it is sent to the admin cluster.
+func ValidateTKSPolicy(tksPolicy *TKSPolicy) field.ErrorList {
+	var errs field.ErrorList
+
+	if tksPolicy.Name == "" {
+		errs = append(errs, field.Required(field.NewPath("metadata", "name"), ""))
+	} else {
+		for _, msg := range validation.IsDNS1123Subdomain(tksPolicy.Name) {
+			errs = append(errs, field.Invalid(field.NewPath("metadata", "name"), tksPolicy.Name, msg))
+		}
+	}
+
+	specPath := field.NewPath("spec")
+	spec := tksPolicy.Spec
+	if spec.Template == "" {
+		errs = append(errs, field.Required(specPath.Child("template"), ""))
+	}
+	for i, cluster := range spec.Clusters {
+		if cluster == "" {
+			errs = append(errs, field.Required(specPath.Child("clusters").Index(i), ""))
+		}
+	}
+
+	if spec.Params != nil {
+		raw := bytes.TrimSpace(spec.Params.Raw)
+		if !json.Valid(raw) {
+			errs = append(errs, field.Invalid(specPath.Child("params"), string(spec.Params.Raw), "must be valid JSON"))
+		} else if len(raw) == 0 || raw[0] != '{' {
+			errs = append(errs, field.Invalid(specPath.Child("params"), string(spec.Params.Raw), "must be a JSON object"))
+		}
+	}
+
+	if spec.EnforcementAction != "" {
+		valid := false
+		for _, action := range enforcementActions {
+			valid = valid || spec.EnforcementAction == action
+		}
+		if !valid {
+			errs = append(errs, field.NotSupported(specPath.Child("enforcementAction"), spec.EnforcementAction, enforcementActions))
+		}
+	}
+
+	if spec.Match != nil {
+		matchPath := specPath.Child("match")
+		for i, ns := range spec.Match.Namespaces {
+			for _, msg := range validation.IsDNS1123Label(ns) {
+				errs = append(errs, field.Invalid(matchPath.Child("namespaces").Index(i), ns, msg))
+			}
+		}
+		for i, ns := range spec.Match.ExcludedNamespaces {
+			for _, msg := range validation.IsDNS1123Label(ns) {
+				errs = append(errs, field.Invalid(matchPath.Child("excludedNamespaces").Index(i), ns, msg))
+			}
+		}
+		for i, kinds := range spec.Match.Kinds {
+			if len(kinds.Kinds) == 0 {
+				errs = append(errs, field.Required(matchPath.Child("kinds").Index(i).Child("kinds"), ""))
+			}
+		}
+	}
+
+	return errs
+}
+
+func GetTKSPolicy(dc dynamic.Interface, namespace string, name string) (*TKSPolicy, error) {
+	resource, err := dc.Resource(TKSPolicyGVR).Namespace(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, newResourceError("get", TKSPolicyGVR.Resource, namespace, name, err)
+	}
+
+	var tksPolicy TKSPolicy
+	if err := fromUnstructured(TKSPolicyGVR.Resource, resource, &tksPolicy); err != nil {
+		return nil, err
+	}
+	return &tksPolicy, nil
+}
+
+func CreateTKSPolicy(dc dynamic.Interface, namespace string, tksPolicy *TKSPolicy) (*TKSPolicy, error) {
+	obj, err := policyToUnstructured("create", namespace, tksPolicy)
+	if err != nil {
+		return nil, err
+	}
+	unstructured.RemoveNestedField(obj.Object, "metadata", "resourceVersion")
+
+	created, err := dc.Resource(TKSPolicyGVR).Namespace(namespace).Create(context.TODO(), obj, metav1.CreateOptions{})
+	if err != nil {
+		return nil, newResourceError("create", TKSPolicyGVR.Resource, namespace, tksPolicy.Name, err)
+	}
+	return policyFromUnstructured(created)
+}
+
+// UpdateTKSPolicy replaces the spec of an existing TKSPolicy.
+// The policy must carry the resourceVersion it was read with, the update fails with ErrConflict
+// when the policy has been changed in the meantime.
+func UpdateTKSPolicy(dc dynamic.Interface, namespace string, tksPolicy *TKSPolicy) (*TKSPolicy, error) {
+	if tksPolicy.ResourceVersion == "" {
+		return nil, &ResourceError{Op: "update", Resource: TKSPolicyGVR.Resource, Namespace: namespace, Name: tksPolicy.Name,
+			Kind: ErrInvalid, Err: field.Required(field.NewPath("metadata", "resourceVersion"), "required for update")}
+	}
+
+	obj, err := policyToUnstructured("update", namespace, tksPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := dc.Resource(TKSPolicyGVR).Namespace(namespace).Update(context.TODO(), obj, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, newResourceError("update", TKSPolicyGVR.Resource, namespace, tksPolicy.Name, err)
+	}
+	return policyFromUnstructured(updated)
+}
+
+// ApplyTKSPolicy creates or updates a TKSPolicy with server-side apply.
+// Only the fields set in tksPolicy are owned by fieldManager: null and empty lists and objects are left out
+// of the apply, so that they stay with their current manager. Force takes over fields owned by other managers.
+func ApplyTKSPolicy(dc dynamic.Interface, namespace string, tksPolicy *TKSPolicy, fieldManager string, force bool) (*TKSPolicy, error) {
+	obj, err := policyToUnstructured("apply", namespace, tksPolicy)
+	if err != nil {
+		return nil, err
+	}
+	pruneEmpty(obj.Object)
+	unstructured.RemoveNestedField(obj.Object, "metadata", "resourceVersion")
+	unstructured.RemoveNestedField(obj.Object, "metadata", "managedFields")
+	if fieldManager == "" {
+		fieldManager = TKSPolicyFieldManager
+	}
+
+	applied, err := dc.Resource(TKSPolicyGVR).Namespace(namespace).Apply(context.TODO(), tksPolicy.Name, obj,
+		metav1.ApplyOptions{FieldManager: fieldManager, Force: force})
+	if err != nil {
+		return nil, newResourceError("apply", TKSPolicyGVR.Resource, namespace, tksPolicy.Name, err)
+	}
+	return policyFromUnstructured(applied)
+}
+
+// DeleteTKSPolicy deletes a TKSPolicy and waits until the policy operator has removed it from every cluster,
+// that is until the policy is gone or Status.Clusters is empty.
+func DeleteTKSPolicy(dc dynamic.Interface, namespace string, name string, opts DeleteOptions) error {
+	resourceClient := dc.Resource(TKSPolicyGVR).Namespace(namespace)
+
+	propagation := metav1.DeletePropagationForeground
+	err := resourceClient.Delete(context.TODO(), name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil {
+		return newResourceError("delete", TKSPolicyGVR.Resource, namespace, name, err)
+	}
+	if opts.Timeout <= 0 {
+		return nil
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 2 * time.Second
+	}
+
+	var remaining []string
+	err = wait.PollUntilContextTimeout(context.TODO(), opts.Interval, opts.Timeout, true,
+		func(ctx context.Context) (bool, error) {
+			tksPolicy, err := GetTKSPolicy(dc, namespace, name)
+			if err != nil {
+				if errors.Is(err, ErrNotFound) {
+					return true, nil
+				}
+				return false, err
+			}
+			remaining = remaining[:0]
+			for cluster := range tksPolicy.Status.Clusters {
+				remaining = append(remaining, cluster)
+			}
+			sort.Strings(remaining)
+			return len(remaining) == 0, nil
+		})
+	if err != nil && wait.Interrupted(err) {
+		return &ResourceError{Op: "delete", Resource: TKSPolicyGVR.Resource, Namespace: namespace, Name: name,
+			Err: fmt.Errorf("policy still present on clusters %v: %w", remaining, err)}
+	}
+	return err
+}
+
+func policyToUnstructured(op string, namespace string, tksPolicy *TKSPolicy) (*unstructured.Unstructured, error) {
+	if errs := ValidateTKSPolicy(tksPolicy); len(errs) > 0 {
+		return nil, &ResourceError{Op: op, Resource: TKSPolicyGVR.Resource, Namespace: namespace, Name: tksPolicy.Name,
+			Kind: ErrInvalid, Err: errs.ToAggregate()}
+	}
+
+	if tksPolicy.Namespace != "" && tksPolicy.Namespace != namespace {
+		return nil, &ResourceError{Op: op, Resource: TKSPolicyGVR.Resource, Namespace: namespace, Name: tksPolicy.Name,
+			Kind: ErrInvalid, Err: field.Invalid(field.NewPath("metadata", "namespace"), tksPolicy.Namespace,
+				fmt.Sprintf("does not match the namespace %s", namespace))}
+	}
+
+	p := *tksPolicy
+	p.APIVersion = TKSPolicyGVR.GroupVersion().String()
+	p.Kind = "TKSPolicy"
+	p.Namespace = namespace
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&p)
+	if err != nil {
+		return nil, &ResourceError{Op: op, Resource: TKSPolicyGVR.Resource, Namespace: namespace, Name: tksPolicy.Name,
+			Kind: ErrConversion, Err: err}
+	}
+	delete(content, "status")
+	unstructured.RemoveNestedField(content, "metadata", "creationTimestamp")
+	return &unstructured.Unstructured{Object: content}, nil
+}
+
+// pruneEmpty removes the null values and the empty lists and objects of an unstructured object
+func pruneEmpty(obj map[string]interface{}) {
+	for key, value := range obj {
+		switch v := value.(type) {
+		case nil:
+			delete(obj, key)
+		case map[string]interface{}:
+			pruneEmpty(v)
+			if len(v) == 0 {
+				delete(obj, key)
+			}
+		case []interface{}:
+			for _, item := range v {
+				if m, ok := item.(map[string]interface{}); ok {
+					pruneEmpty(m)
+				}
+			}
+			if len(v) == 0 {
+				delete(obj, key)
+			}
+		}
+	}
+}
+
+func policyFromUnstructured(u *unstructured.Unstructured) (*TKSPolicy, error) {
+	var tksPolicy TKSPolicy
+	if err := fromUnstructured(TKSPolicyGVR.Resource, u, &tksPolicy); err != nil {
+		return nil, err
+	}
+	return &tksPolicy, nil
+}
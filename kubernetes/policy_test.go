@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newTKSPolicy(name string) *TKSPolicy {
+	tksPolicy := &TKSPolicy{}
+	tksPolicy.Name = name
+	tksPolicy.Spec = TKSPolicySpec{
+		Clusters:          []string{"c1", "c2"},
+		Template:          "k8srequiredlabels",
+		Params:            &apiextensionsv1.JSON{Raw: []byte(`{"labels":[{"key":"owner"}]}`)},
+		Match:             &Match{Namespaces: []string{"default"}, Kinds: []Kinds{{APIGroups: []string{""}, Kinds: []string{"Pod"}}}},
+		EnforcementAction: "warn",
+	}
+	return tksPolicy
+}
+
+func TestValidateTKSPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(p *TKSPolicy)
+		want   string
+	}{
+		{"valid", func(p *TKSPolicy) {}, ""},
+		{"name", func(p *TKSPolicy) { p.Name = "" }, "metadata.name"},
+		{"template", func(p *TKSPolicy) { p.Spec.Template = "" }, "spec.template"},
+		{"cluster", func(p *TKSPolicy) { p.Spec.Clusters = []string{"c1", ""} }, "spec.clusters[1]"},
+		{"params json", func(p *TKSPolicy) { p.Spec.Params.Raw = []byte(`{"labels":`) }, "spec.params"},
+		{"params object", func(p *TKSPolicy) { p.Spec.Params.Raw = []byte(`[1]`) }, "spec.params"},
+		{"enforcement action", func(p *TKSPolicy) { p.Spec.EnforcementAction = "block" }, "spec.enforcementAction"},
+		{"namespace", func(p *TKSPolicy) { p.Spec.Match.Namespaces = []string{"Default"} }, "spec.match.namespaces[0]"},
+		{"kinds", func(p *TKSPolicy) { p.Spec.Match.Kinds = []Kinds{{}} }, "spec.match.kinds[0].kinds"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tksPolicy := newTKSPolicy("p1")
+			tt.modify(tksPolicy)
+
+			errs := ValidateTKSPolicy(tksPolicy)
+			if tt.want == "" {
+				if len(errs) != 0 {
+					t.Errorf("want no error got (%v)", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || errs[0].Field != tt.want {
+				t.Errorf("want error on (%s) got (%v)", tt.want, errs)
+			}
+		})
+	}
+}
+
+func TestCreateTKSPolicy(t *testing.T) {
+	dc := newFakeDynamicClient()
+
+	created, err := CreateTKSPolicy(dc, "org", newTKSPolicy("p1"))
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if created.Namespace != "org" || created.Spec.EnforcementAction != "warn" || string(created.Spec.Params.Raw) != `{"labels":[{"key":"owner"}]}` {
+		t.Errorf("unexpected policy (%+v)", created)
+	}
+
+	if _, err := CreateTKSPolicy(dc, "org", newTKSPolicy("p1")); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("want (%v) got (%v)", ErrAlreadyExists, err)
+	}
+}
+
+func TestCreateTKSPolicyInvalid(t *testing.T) {
+	dc := newFakeDynamicClient()
+	tksPolicy := newTKSPolicy("p1")
+	tksPolicy.Spec.EnforcementAction = "block"
+
+	_, err := CreateTKSPolicy(dc, "org", tksPolicy)
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("want (%v) got (%v)", ErrInvalid, err)
+	}
+	if len(dc.Actions()) != 0 {
+		t.Errorf("want no api call got (%v)", dc.Actions())
+	}
+}
+
+func TestUpdateTKSPolicy(t *testing.T) {
+	dc := newFakeDynamicClient()
+	if _, err := CreateTKSPolicy(dc, "org", newTKSPolicy("p1")); err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+
+	tksPolicy, err := GetTKSPolicy(dc, "org", "p1")
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if _, err := UpdateTKSPolicy(dc, "org", tksPolicy); !errors.Is(err, ErrInvalid) {
+		t.Errorf("without resourceVersion: want (%v) got (%v)", ErrInvalid, err)
+	}
+
+	tksPolicy.ResourceVersion = "1"
+	tksPolicy.Spec.EnforcementAction = "deny"
+	updated, err := UpdateTKSPolicy(dc, "org", tksPolicy)
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if updated.Spec.EnforcementAction != "deny" {
+		t.Errorf("want (%s) got (%s)", "deny", updated.Spec.EnforcementAction)
+	}
+}
+
+func TestUpdateTKSPolicyConflict(t *testing.T) {
+	dc := newFakeDynamicClient()
+	gr := schema.GroupResource{Group: TKSPolicyGVR.Group, Resource: TKSPolicyGVR.Resource}
+	dc.PrependReactor("update", TKSPolicyGVR.Resource,
+		reactWithError(apierrors.NewConflict(gr, "p1", errors.New("the object has been modified"))))
+
+	tksPolicy := newTKSPolicy("p1")
+	tksPolicy.ResourceVersion = "1"
+	if _, err := UpdateTKSPolicy(dc, "org", tksPolicy); !errors.Is(err, ErrConflict) {
+		t.Errorf("want (%v) got (%v)", ErrConflict, err)
+	}
+}
+
+func TestApplyTKSPolicy(t *testing.T) {
+	dc := newFakeDynamicClient()
+	var patch k8stesting.PatchAction
+	dc.PrependReactor("patch", TKSPolicyGVR.Resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch = action.(k8stesting.PatchAction)
+		obj := &unstructured.Unstructured{}
+		if err := json.Unmarshal(patch.GetPatch(), &obj.Object); err != nil {
+			return true, nil, err
+		}
+		return true, obj, nil
+	})
+
+	tksPolicy := newTKSPolicy("p1")
+	tksPolicy.ResourceVersion = "7"
+	tksPolicy.Status.Clusters = map[string]PolicyStatus{"c1": {ConstraintStatus: "ready"}}
+	applied, err := ApplyTKSPolicy(dc, "org", tksPolicy, "", true)
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if applied.Spec.Template != "k8srequiredlabels" {
+		t.Errorf("unexpected policy (%+v)", applied)
+	}
+
+	if patch.GetPatchType() != types.ApplyPatchType {
+		t.Errorf("want (%s) got (%s)", types.ApplyPatchType, patch.GetPatchType())
+	}
+	body := string(patch.GetPatch())
+	for _, unwanted := range []string{`"status"`, `"resourceVersion"`} {
+		if strings.Contains(body, unwanted) {
+			t.Errorf("apply body must not contain %s: %s", unwanted, body)
+		}
+	}
+	if !strings.Contains(body, `"kind":"TKSPolicy"`) {
+		t.Errorf("apply body must contain kind: %s", body)
+	}
+
+	// the fields which are not set are not owned by the field manager
+	tksPolicy = &TKSPolicy{}
+	tksPolicy.Name = "p2"
+	tksPolicy.Spec.Template = "k8srequiredlabels"
+	if _, err := ApplyTKSPolicy(dc, "org", tksPolicy, "", false); err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	var sent map[string]interface{}
+	if err := json.Unmarshal(patch.GetPatch(), &sent); err != nil {
+		t.Fatal(err)
+	}
+	if spec, _, _ := unstructured.NestedMap(sent, "spec"); len(spec) != 1 || spec["template"] != "k8srequiredlabels" {
+		t.Errorf("apply body must only contain the template: %s", patch.GetPatch())
+	}
+}
+
+func TestTKSPolicyNamespaceMismatch(t *testing.T) {
+	dc := newFakeDynamicClient()
+	tksPolicy := newTKSPolicy("p1")
+	tksPolicy.Namespace = "other"
+
+	if _, err := CreateTKSPolicy(dc, "org", tksPolicy); !errors.Is(err, ErrInvalid) {
+		t.Errorf("create: want (%v) got (%v)", ErrInvalid, err)
+	}
+	if _, err := ApplyTKSPolicy(dc, "org", tksPolicy, "", false); !errors.Is(err, ErrInvalid) {
+		t.Errorf("apply: want (%v) got (%v)", ErrInvalid, err)
+	}
+	if len(dc.Actions()) != 0 {
+		t.Errorf("want no api call got (%v)", dc.Actions())
+	}
+
+	tksPolicy.Namespace = "org"
+	if _, err := CreateTKSPolicy(dc, "org", tksPolicy); err != nil {
+		t.Errorf("unexpected error - %s", err)
+	}
+}
+
+func TestDeleteTKSPolicyWaitsForClusters(t *testing.T) {
+	dc := newFakeDynamicClient()
+	if _, err := CreateTKSPolicy(dc, "org", newTKSPolicy("p1")); err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+
+	// the operator removes the constraint from one cluster per status check
+	remaining := []string{"c1", "c2"}
+	gets := 0
+	dc.PrependReactor("delete", TKSPolicyGVR.Resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, nil
+	})
+	dc.PrependReactor("get", TKSPolicyGVR.Resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		clusters := map[string]interface{}{}
+		for _, c := range remaining {
+			clusters[c] = map[string]interface{}{"constraintStatus": "deleting"}
+		}
+		if len(remaining) > 0 {
+			remaining = remaining[1:]
+		}
+		u := newUnstructured("TKSPolicy", "org", "p1", map[string]interface{}{"template": "t1"})
+		u.Object["status"] = map[string]interface{}{"clusters": clusters}
+		return true, u, nil
+	})
+
+	err := DeleteTKSPolicy(dc, "org", "p1", DeleteOptions{Timeout: 5 * time.Second, Interval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if gets != 3 {
+		t.Errorf("want 3 status checks got (%d)", gets)
+	}
+}
+
+func TestDeleteTKSPolicyTimeout(t *testing.T) {
+	dc := newFakeDynamicClient()
+	dc.PrependReactor("delete", TKSPolicyGVR.Resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, nil
+	})
+	dc.PrependReactor("get", TKSPolicyGVR.Resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+		u := newUnstructured("TKSPolicy", "org", "p1", map[string]interface{}{"template": "t1"})
+		u.Object["status"] = map[string]interface{}{"clusters": map[string]interface{}{"c1": map[string]interface{}{}}}
+		return true, u, nil
+	})
+
+	err := DeleteTKSPolicy(dc, "org", "p1", DeleteOptions{Timeout: 20 * time.Millisecond, Interval: time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "[c1]") {
+		t.Errorf("want timeout with remaining cluster c1 got (%v)", err)
+	}
+}
+
+func TestDeleteTKSPolicyNotFound(t *testing.T) {
+	dc := newFakeDynamicClient()
+	if err := DeleteTKSPolicy(dc, "org", "p1", DeleteOptions{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("want (%v) got (%v)", ErrNotFound, err)
+	}
+}
+
+func TestDeleteTKSPolicyGone(t *testing.T) {
+	dc := newFakeDynamicClient()
+	if _, err := CreateTKSPolicy(dc, "org", newTKSPolicy("p1")); err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if err := DeleteTKSPolicy(dc, "org", "p1", DeleteOptions{Timeout: time.Second, Interval: time.Millisecond}); err != nil {
+		t.Errorf("unexpected error - %s", err)
+	}
+}
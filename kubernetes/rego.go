@@ -0,0 +1,326 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	RegoSeverityError   = "error"
+	RegoSeverityWarning = "warning"
+)
+
+// RegoModule is a rego module of a TKSPolicyTemplate target.
+// Source is where the module was found: "rego", "libs" or "code" (the source of a code entry with the Rego engine).
+type RegoModule struct {
+	Target  string `json:"target"`
+	Source  string `json:"source"`
+	Index   int    `json:"index"`
+	Package string `json:"package"`
+	Lib     bool   `json:"lib"`
+	Rego    string `json:"rego"`
+}
+
+func (m RegoModule) String() string {
+	switch {
+	case m.Source == "libs":
+		return fmt.Sprintf("%s/libs[%d]", m.Target, m.Index)
+	case m.Lib:
+		return fmt.Sprintf("%s/%s.libs[%d]", m.Target, m.Source, m.Index)
+	}
+	return m.Target + "/" + m.Source
+}
+
+type RegoIssue struct {
+	Module   string `json:"module"`
+	Line     int    `json:"line,omitempty"`
+	Severity string `json:"severity" enums:"error,warning"`
+	Message  string `json:"message"`
+}
+
+type RegoLintReport struct {
+	Template string       `json:"template"`
+	Modules  []RegoModule `json:"modules"`
+	Issues   []RegoIssue  `json:"issues"`
+	Valid    bool         `json:"valid"`
+}
+
+var (
+	regoPackagePattern    = regexp.MustCompile(`(?m)^\s*package\s+([A-Za-z_][\w.]*)`)
+	regoViolationPattern  = regexp.MustCompile(`(?m)^\s*violation\s*(\[|\{|contains\b|if\b)`)
+	regoImportPattern     = regexp.MustCompile(`(?m)^\s*import\s+data\.(lib(?:\.[A-Za-z_]\w*)+)`)
+	regoParamPattern      = regexp.MustCompile(`input\.parameters(?:\.([A-Za-z_]\w*)|\[\s*"([^"]+)"\s*\])`)
+	regoParamAliasPattern = regexp.MustCompile(`input\.parameters\s*($|[^.\[\w])`)
+)
+
+// ExtractRegoModules returns the main rego and the libs of every target of the template,
+// including the sources of code entries with the Rego engine.
+func ExtractRegoModules(tksPolicyTemplate *TKSPolicyTemplate) []RegoModule {
+	var modules []RegoModule
+	add := func(target string, source string, index int, lib bool, rego string) {
+		modules = append(modules, RegoModule{
+			Target:  target,
+			Source:  source,
+			Index:   index,
+			Package: regoPackage(rego),
+			Lib:     lib,
+			Rego:    rego,
+		})
+	}
+
+	for _, target := range tksPolicyTemplate.Spec.Targets {
+		if target.Rego != "" {
+			add(target.Target, "rego", 0, false, target.Rego)
+		}
+		for i, lib := range target.Libs {
+			add(target.Target, "libs", i, true, lib)
+		}
+
+		for _, code := range target.Code {
+			if !strings.EqualFold(code.Engine, "rego") || code.Source == nil {
+				continue
+			}
+			source, ok := code.Source.Value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if rego, ok := source["rego"].(string); ok && rego != "" {
+				add(target.Target, "code", 0, false, rego)
+			}
+			if libs, ok := source["libs"].([]interface{}); ok {
+				for i, lib := range libs {
+					if s, ok := lib.(string); ok {
+						add(target.Target, "code", i, true, s)
+					}
+				}
+			}
+		}
+	}
+	return modules
+}
+
+func LintTKSPolicyTemplates(dc dynamic.Interface, namespace string) ([]RegoLintReport, error) {
+	tksPolicyTemplates, err := GetTKSPolicyTemplates(dc, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]RegoLintReport, 0, len(tksPolicyTemplates))
+	for i := range tksPolicyTemplates {
+		reports = append(reports, LintTKSPolicyTemplate(&tksPolicyTemplates[i]))
+	}
+	return reports, nil
+}
+
+// LintTKSPolicyTemplate runs static checks on the rego of a template:
+//   - every module declares a package, libs live under the lib package
+//   - the main module defines a violation rule
+//   - braces, brackets and parentheses are balanced
+//   - imported data.lib packages are provided by the libs
+//   - input.parameters.<name> references exist in the CRD OpenAPI v3 schema
+//
+// Schema parameters which are never referenced are reported as warnings.
+// The checks are lexical, parameters read through an alias (params := input.parameters) are not followed.
+func LintTKSPolicyTemplate(tksPolicyTemplate *TKSPolicyTemplate) RegoLintReport {
+	report := RegoLintReport{
+		Template: tksPolicyTemplate.GetName(),
+		Modules:  ExtractRegoModules(tksPolicyTemplate),
+		Issues:   []RegoIssue{},
+	}
+	addIssue := func(module RegoModule, line int, severity string, format string, a ...interface{}) {
+		report.Issues = append(report.Issues, RegoIssue{
+			Module:   module.String(),
+			Line:     line,
+			Severity: severity,
+			Message:  fmt.Sprintf(format, a...),
+		})
+	}
+
+	if len(report.Modules) == 0 {
+		report.Issues = append(report.Issues, RegoIssue{Severity: RegoSeverityError, Message: "template has no rego module"})
+	}
+
+	params := templateParameters(tksPolicyTemplate)
+	libPackages := make(map[string]bool)
+	for _, module := range report.Modules {
+		if module.Lib && module.Package != "" {
+			libPackages[module.Target+"/"+module.Package] = true
+		}
+	}
+
+	referenced := make(map[string]bool)
+	aliased := false
+	for _, module := range report.Modules {
+		code := stripRegoComments(module.Rego)
+		aliased = aliased || regoParamAliasPattern.MatchString(code)
+
+		switch {
+		case module.Package == "":
+			addIssue(module, 0, RegoSeverityError, "package declaration is missing")
+		case module.Lib && module.Package != "lib" && !strings.HasPrefix(module.Package, "lib."):
+			addIssue(module, lineOf(code, regoPackagePattern.FindStringIndex(code)[0]), RegoSeverityError,
+				"lib package %s must be under lib", module.Package)
+		}
+
+		if !module.Lib && !regoViolationPattern.MatchString(code) {
+			addIssue(module, 0, RegoSeverityError, "violation rule is not defined")
+		}
+
+		if line, msg := checkRegoBrackets(code); msg != "" {
+			addIssue(module, line, RegoSeverityError, "%s", msg)
+		}
+
+		for _, m := range regoImportPattern.FindAllStringSubmatchIndex(code, -1) {
+			pkg := code[m[2]:m[3]]
+			if !libPackages[module.Target+"/"+pkg] {
+				addIssue(module, lineOf(code, m[0]), RegoSeverityError, "imported package data.%s is not provided by the libs", pkg)
+			}
+		}
+
+		reported := make(map[string]bool)
+		for _, m := range regoParamPattern.FindAllStringSubmatchIndex(code, -1) {
+			var name string
+			if m[2] >= 0 {
+				name = code[m[2]:m[3]]
+			} else {
+				name = code[m[4]:m[5]]
+			}
+			referenced[name] = true
+			if params == nil {
+				if !reported[""] {
+					addIssue(module, lineOf(code, m[0]), RegoSeverityError, "input.parameters is referenced but the template has no parameter schema")
+					reported[""] = true
+				}
+				continue
+			}
+			if !slices.Contains(params, name) && !reported[name] {
+				addIssue(module, lineOf(code, m[0]), RegoSeverityError, "parameter %s is not defined in the CRD schema", name)
+				reported[name] = true
+			}
+		}
+	}
+
+	if !aliased {
+		for _, name := range params {
+			if !referenced[name] {
+				report.Issues = append(report.Issues, RegoIssue{Severity: RegoSeverityWarning,
+					Message: fmt.Sprintf("parameter %s is defined in the CRD schema but never referenced", name)})
+			}
+		}
+	}
+
+	report.Valid = true
+	for _, issue := range report.Issues {
+		if issue.Severity == RegoSeverityError {
+			report.Valid = false
+		}
+	}
+	return report
+}
+
+// templateParameters returns the top-level parameter names of the template schema, nil when there is no schema.
+func templateParameters(tksPolicyTemplate *TKSPolicyTemplate) []string {
+	validation := tksPolicyTemplate.Spec.CRD.Spec.Validation
+	if validation == nil || validation.OpenAPIV3Schema == nil {
+		return nil
+	}
+	params := make([]string, 0, len(validation.OpenAPIV3Schema.Properties))
+	for name := range validation.OpenAPIV3Schema.Properties {
+		params = append(params, name)
+	}
+	sort.Strings(params)
+	return params
+}
+
+func regoPackage(rego string) string {
+	m := regoPackagePattern.FindStringSubmatch(stripRegoComments(rego))
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// stripRegoComments blanks out # comments, keeping offsets and line numbers of the remaining code.
+func stripRegoComments(rego string) string {
+	out := []byte(rego)
+	inString, inRaw := false, false
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		switch {
+		case inString:
+			if c == '\\' {
+				i++
+			} else if c == '"' || c == '\n' {
+				inString = false
+			}
+		case inRaw:
+			if c == '`' {
+				inRaw = false
+			}
+		case c == '"':
+			inString = true
+		case c == '`':
+			inRaw = true
+		case c == '#':
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		}
+	}
+	return string(out)
+}
+
+// checkRegoBrackets returns the line and message of the first unbalanced bracket outside of strings.
+func checkRegoBrackets(code string) (int, string) {
+	pairs := map[byte]byte{')': '(', ']': '[', '}': '{'}
+	type open struct {
+		c    byte
+		line int
+	}
+	var stack []open
+	line := 1
+	inString, inRaw := false, false
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		if c == '\n' {
+			line++
+		}
+		switch {
+		case inString:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+		case inRaw:
+			if c == '`' {
+				inRaw = false
+			}
+		case c == '"':
+			inString = true
+		case c == '`':
+			inRaw = true
+		case c == '(' || c == '[' || c == '{':
+			stack = append(stack, open{c, line})
+		case c == ')' || c == ']' || c == '}':
+			if len(stack) == 0 || stack[len(stack)-1].c != pairs[c] {
+				return line, fmt.Sprintf("unexpected %q", c)
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if len(stack) > 0 {
+		last := stack[len(stack)-1]
+		return last.line, fmt.Sprintf("unclosed %q", last.c)
+	}
+	return 0, ""
+}
+
+func lineOf(s string, offset int) int {
+	return strings.Count(s[:offset], "\n") + 1
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+const requiredLabelsRego = `package k8srequiredlabels
+
+import data.lib.helpers
+
+# violation when a required label is missing
+violation[{"msg": msg}] {
+  provided := {label | input.review.object.metadata.labels[label]}
+  required := {label | label := input.parameters.labels[_]}
+  missing := required - provided
+  count(missing) > 0
+  msg := sprintf("missing labels: %v", [missing])
+}
+`
+
+const helpersLib = `package lib.helpers
+
+name(obj) = n {
+  n := obj.metadata.name
+}
+`
+
+func newRegoTemplate(rego string, libs ...string) *TKSPolicyTemplate {
+	tksPolicyTemplate := &TKSPolicyTemplate{}
+	tksPolicyTemplate.Name = "k8srequiredlabels"
+	tksPolicyTemplate.Spec.CRD.Spec.Validation = &Validation{
+		OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+			Type: "object",
+			Properties: map[string]apiextensionsv1.JSONSchemaProps{
+				"labels": {Type: "array"},
+			},
+		},
+	}
+	tksPolicyTemplate.Spec.Targets = []Target{{
+		Target: "admission.k8s.gatekeeper.sh",
+		Rego:   rego,
+		Libs:   libs,
+	}}
+	return tksPolicyTemplate
+}
+
+func TestExtractRegoModules(t *testing.T) {
+	dc := newFakeDynamicClient(newUnstructured("TKSPolicyTemplate", "org", "k8srequiredlabels", map[string]interface{}{
+		"targets": []interface{}{map[string]interface{}{
+			"target": "admission.k8s.gatekeeper.sh",
+			"code": []interface{}{
+				map[string]interface{}{
+					"engine": "Rego",
+					"source": map[string]interface{}{"rego": requiredLabelsRego, "libs": []interface{}{helpersLib}},
+				},
+				map[string]interface{}{
+					"engine": "K8sNativeValidation",
+					"source": map[string]interface{}{"validations": []interface{}{}},
+				},
+			},
+		}},
+	}))
+	tksPolicyTemplate, err := GetTKSPolicyTemplate(dc, "org", "k8srequiredlabels")
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+
+	modules := ExtractRegoModules(tksPolicyTemplate)
+	if len(modules) != 2 {
+		t.Fatalf("want 2 modules got (%+v)", modules)
+	}
+	if modules[0].Package != "k8srequiredlabels" || modules[0].Lib || modules[0].String() != "admission.k8s.gatekeeper.sh/code" {
+		t.Errorf("unexpected main module (%+v)", modules[0])
+	}
+	if modules[1].Package != "lib.helpers" || !modules[1].Lib || modules[1].String() != "admission.k8s.gatekeeper.sh/code.libs[0]" {
+		t.Errorf("unexpected lib module (%+v)", modules[1])
+	}
+}
+
+func TestLintTKSPolicyTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		rego string
+		libs []string
+		want []string
+	}{
+		{"valid", requiredLabelsRego, []string{helpersLib}, nil},
+		{"missing package", strings.Replace(requiredLabelsRego, "package k8srequiredlabels", "", 1), []string{helpersLib},
+			[]string{"package declaration is missing"}},
+		{"missing violation", strings.Replace(requiredLabelsRego, "violation[", "deny[", 1), []string{helpersLib},
+			[]string{"violation rule is not defined"}},
+		{"unknown parameter", strings.Replace(requiredLabelsRego, "input.parameters.labels", "input.parameters.label", 1), []string{helpersLib},
+			[]string{"parameter label is not defined in the CRD schema", "parameter labels is defined in the CRD schema but never referenced"}},
+		{"missing lib", requiredLabelsRego, nil,
+			[]string{"imported package data.lib.helpers is not provided by the libs"}},
+		{"lib package", requiredLabelsRego, []string{helpersLib, "package helpers\n"},
+			[]string{"lib package helpers must be under lib"}},
+		{"unbalanced", strings.Replace(requiredLabelsRego, "count(missing) > 0", "count(missing > 0", 1), []string{helpersLib},
+			[]string{`unexpected '}'`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := LintTKSPolicyTemplate(newRegoTemplate(tt.rego, tt.libs...))
+
+			var got []string
+			for _, issue := range report.Issues {
+				got = append(got, issue.Message)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want (%v) got (%v)", tt.want, got)
+			}
+			if report.Valid != (len(tt.want) == 0) {
+				t.Errorf("want valid (%t) got (%t)", len(tt.want) == 0, report.Valid)
+			}
+		})
+	}
+}
+
+func TestLintTKSPolicyTemplateIssueLine(t *testing.T) {
+	rego := strings.Replace(requiredLabelsRego, "input.parameters.labels", `input.parameters["names"]`, 1)
+	report := LintTKSPolicyTemplate(newRegoTemplate(rego, helpersLib))
+
+	if len(report.Issues) == 0 || report.Issues[0].Line != 8 || report.Issues[0].Module != "admission.k8s.gatekeeper.sh/rego" {
+		t.Errorf("want issue on line 8 of the main rego got (%+v)", report.Issues)
+	}
+}
+
+func TestLintTKSPolicyTemplateWithoutRego(t *testing.T) {
+	report := LintTKSPolicyTemplate(&TKSPolicyTemplate{})
+	if report.Valid || len(report.Issues) != 1 {
+		t.Errorf("want invalid report got (%+v)", report)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"slices"
+	"sort"
+
+	"k8s.io/client-go/dynamic"
+)
+
+// TemplateRollout is the rollout progress of a TKSPolicyTemplate to its target clusters (Spec.Clusters).
+// A target cluster is up-to-date when its ConstraintTemplate is ready on Spec.Version.
+type TemplateRollout struct {
+	Template       string            `json:"template"`
+	TemplateID     string            `json:"templateId,omitempty"`
+	Version        string            `json:"version"`
+	ToLatest       []string          `json:"toLatest,omitempty"`
+	TargetClusters int               `json:"targetClusters"`
+	UpToDate       int               `json:"upToDate"`
+	Progress       float64           `json:"progress"`
+	Complete       bool              `json:"complete"`
+	Ready          []string          `json:"ready"`
+	Applying       []string          `json:"applying"`
+	Deleting       []string          `json:"deleting"`
+	Error          []ClusterReason   `json:"error"`
+	Outdated       []OutdatedCluster `json:"outdated"`
+	NoStatus       []string          `json:"noStatus"`
+	Untargeted     []string          `json:"untargeted"`
+}
+
+type ClusterReason struct {
+	Cluster string `json:"cluster"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+type OutdatedCluster struct {
+	Cluster string `json:"cluster"`
+	Version string `json:"version"`
+}
+
+func GetTemplateRollouts(dc dynamic.Interface, namespace string) ([]TemplateRollout, error) {
+	tksPolicyTemplates, err := GetTKSPolicyTemplates(dc, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	rollouts := make([]TemplateRollout, 0, len(tksPolicyTemplates))
+	for _, tksPolicyTemplate := range tksPolicyTemplates {
+		rollouts = append(rollouts, GetTemplateRollout(tksPolicyTemplate))
+	}
+	return rollouts, nil
+}
+
+func GetTemplateRollout(tksPolicyTemplate TKSPolicyTemplate) TemplateRollout {
+	spec := tksPolicyTemplate.Spec
+	rollout := TemplateRollout{
+		Template:       tksPolicyTemplate.GetName(),
+		TemplateID:     tksPolicyTemplate.Labels["tks/policy-template-id"],
+		Version:        spec.Version,
+		ToLatest:       spec.ToLatest,
+		TargetClusters: len(spec.Clusters),
+		Ready:          []string{},
+		Applying:       []string{},
+		Deleting:       []string{},
+		Error:          []ClusterReason{},
+		Outdated:       []OutdatedCluster{},
+		NoStatus:       []string{},
+		Untargeted:     []string{},
+	}
+
+	for _, cluster := range spec.Clusters {
+		status, ok := tksPolicyTemplate.Status.TemplateStatus[cluster]
+		if !ok {
+			rollout.NoStatus = append(rollout.NoStatus, cluster)
+			continue
+		}
+
+		switch status.ConstraintTemplateStatus {
+		case "ready":
+			rollout.Ready = append(rollout.Ready, cluster)
+		case "applying":
+			rollout.Applying = append(rollout.Applying, cluster)
+		case "deleting":
+			rollout.Deleting = append(rollout.Deleting, cluster)
+		default:
+			rollout.Error = append(rollout.Error, ClusterReason{Cluster: cluster, Reason: status.Reason})
+		}
+
+		if status.Version != spec.Version {
+			rollout.Outdated = append(rollout.Outdated, OutdatedCluster{Cluster: cluster, Version: status.Version})
+		} else if status.ConstraintTemplateStatus == "ready" {
+			rollout.UpToDate++
+		}
+	}
+
+	// clusters which still report a status but are no longer targeted (e.g. being removed)
+	for cluster := range tksPolicyTemplate.Status.TemplateStatus {
+		if !slices.Contains(spec.Clusters, cluster) {
+			rollout.Untargeted = append(rollout.Untargeted, cluster)
+		}
+	}
+	sort.Strings(rollout.Untargeted)
+
+	if rollout.TargetClusters > 0 {
+		rollout.Progress = float64(rollout.UpToDate) / float64(rollout.TargetClusters) * 100
+	}
+	rollout.Complete = rollout.UpToDate == rollout.TargetClusters
+	return rollout
+}
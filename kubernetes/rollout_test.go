@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newTKSPolicyTemplate(clusters []string, version string, status map[string]TemplateStatus) TKSPolicyTemplate {
+	var tksPolicyTemplate TKSPolicyTemplate
+	tksPolicyTemplate.Name = "k8srequiredlabels"
+	tksPolicyTemplate.Labels = map[string]string{"tks/policy-template-id": "t1"}
+	tksPolicyTemplate.Spec.Clusters = clusters
+	tksPolicyTemplate.Spec.Version = version
+	tksPolicyTemplate.Status.TemplateStatus = status
+	return tksPolicyTemplate
+}
+
+func TestGetTemplateRollout(t *testing.T) {
+	tksPolicyTemplate := newTKSPolicyTemplate([]string{"c1", "c2", "c3", "c4", "c5"}, "v1.0.1",
+		map[string]TemplateStatus{
+			"c1": {ConstraintTemplateStatus: "ready", Version: "v1.0.1"},
+			"c2": {ConstraintTemplateStatus: "ready", Version: "v1.0.0"},
+			"c3": {ConstraintTemplateStatus: "applying", Version: "v1.0.0"},
+			"c4": {ConstraintTemplateStatus: "error", Reason: "rego compile error", Version: "v1.0.1"},
+			"c9": {ConstraintTemplateStatus: "deleting", Version: "v1.0.0"},
+		})
+
+	rollout := GetTemplateRollout(tksPolicyTemplate)
+
+	if rollout.TemplateID != "t1" || rollout.TargetClusters != 5 {
+		t.Errorf("unexpected rollout (%+v)", rollout)
+	}
+	if !reflect.DeepEqual(rollout.Ready, []string{"c1", "c2"}) {
+		t.Errorf("ready: want (%v) got (%v)", []string{"c1", "c2"}, rollout.Ready)
+	}
+	if !reflect.DeepEqual(rollout.Applying, []string{"c3"}) {
+		t.Errorf("applying: want (%v) got (%v)", []string{"c3"}, rollout.Applying)
+	}
+	if want := []ClusterReason{{Cluster: "c4", Reason: "rego compile error"}}; !reflect.DeepEqual(rollout.Error, want) {
+		t.Errorf("error: want (%v) got (%v)", want, rollout.Error)
+	}
+	if want := []OutdatedCluster{{"c2", "v1.0.0"}, {"c3", "v1.0.0"}}; !reflect.DeepEqual(rollout.Outdated, want) {
+		t.Errorf("outdated: want (%v) got (%v)", want, rollout.Outdated)
+	}
+	if !reflect.DeepEqual(rollout.NoStatus, []string{"c5"}) {
+		t.Errorf("no status: want (%v) got (%v)", []string{"c5"}, rollout.NoStatus)
+	}
+	if !reflect.DeepEqual(rollout.Untargeted, []string{"c9"}) {
+		t.Errorf("untargeted: want (%v) got (%v)", []string{"c9"}, rollout.Untargeted)
+	}
+	if rollout.UpToDate != 1 || rollout.Progress != 20 || rollout.Complete {
+		t.Errorf("want 1 up-to-date cluster (20%%) got (%d, %.1f%%, complete %t)", rollout.UpToDate, rollout.Progress, rollout.Complete)
+	}
+}
+
+func TestGetTemplateRolloutComplete(t *testing.T) {
+	tksPolicyTemplate := newTKSPolicyTemplate([]string{"c1"}, "v1.0.1",
+		map[string]TemplateStatus{"c1": {ConstraintTemplateStatus: "ready", Version: "v1.0.1"}})
+
+	rollout := GetTemplateRollout(tksPolicyTemplate)
+	if !rollout.Complete || rollout.Progress != 100 {
+		t.Errorf("want complete rollout got (%+v)", rollout)
+	}
+}
+
+func TestGetTemplateRollouts(t *testing.T) {
+	dc := newFakeDynamicClient(
+		newUnstructured("TKSPolicyTemplate", "org", "t1", map[string]interface{}{
+			"clusters": []interface{}{"c1"},
+			"version":  "v1.0.0",
+		}),
+	)
+
+	rollouts, err := GetTemplateRollouts(dc, "org")
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if len(rollouts) != 1 || !reflect.DeepEqual(rollouts[0].NoStatus, []string{"c1"}) {
+		t.Errorf("want c1 without status got (%+v)", rollouts)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var TKSClusterGVR = schema.GroupVersionResource{
+	Group:    "tkspolicy.openinfradev.github.io",
+	Version:  "v1",
+	Resource: "tksclusters",
+}
+
+var TKSPolicyTemplateGVR = schema.GroupVersionResource{
+	Group:    "tkspolicy.openinfradev.github.io",
+	Version:  "v1",
+	Resource: "tkspolicytemplates",
+}
+
+var TKSPolicyGVR = schema.GroupVersionResource{
+	Group:    "tkspolicy.openinfradev.github.io",
+	Version:  "v1",
+	Resource: "tkspolicies",
+}
+
+// ****************************************************************************************************
+// TKSCluster
+
+type TemplateReference struct {
+	Policies  map[string]string `json:"polices,omitempty"`
+	Templates map[string]string `json:"templates,omitempty"`
+}
+
+type TKSClusterSpec struct {
+	ClusterName string `json:"clusterName"  validate:"required"`
+	Context     string `json:"context"  validate:"required"`
+}
+
+type DeploymentInfo struct {
+	Image         string   `json:"image,omitempty"`
+	Args          []string `json:"args,omitempty"`
+	TotalReplicas int      `json:"totalReplicas,omitempty"`
+	NumReplicas   int      `json:"numReplicas,omitempty"`
+}
+
+type TKSProxy struct {
+	Status            string          `json:"status" enums:"ready,warn,error"`
+	ControllerManager *DeploymentInfo `json:"controllerManager,omitempty"`
+	Audit             *DeploymentInfo `json:"audit,omitempty"`
+}
+
+type TKSClusterStatus struct {
+	Status              string              `json:"status" enums:"running,deleting,error"`
+	Error               string              `json:"error,omitempty"`
+	TKSProxy            TKSProxy            `json:"tksproxy,omitempty"`
+	LastStatusCheckTime int64               `json:"laststatuschecktime,omitempty"`
+	Templates           map[string][]string `json:"templates,omitempty"`
+	LastUpdate          string              `json:"lastUpdate"`
+	UpdateQueue         map[string]bool     `json:"updateQueue,omitempty"`
+}
+
+type TKSCluster struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TKSClusterSpec   `json:"spec,omitempty"`
+	Status TKSClusterStatus `json:"status,omitempty"`
+}
+
+type TKSClusterList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TKSCluster `json:"items"`
+}
+
+// ****************************************************************************************************
+// TKSPolicyTemplate
+
+type Names struct {
+	Kind       string   `json:"kind,omitempty"`
+	ShortNames []string `json:"shortNames,omitempty"`
+}
+
+type Validation struct {
+	OpenAPIV3Schema *apiextensionsv1.JSONSchemaProps `json:"openAPIV3Schema,omitempty"`
+	LegacySchema    *bool                            `json:"legacySchema,omitempty"` // *bool allows for "unset" state which we need to apply appropriate defaults
+}
+
+type CRDSpec struct {
+	Names      Names       `json:"names,omitempty"`
+	Validation *Validation `json:"validation,omitempty"`
+}
+
+type CRD struct {
+	Spec CRDSpec `json:"spec,omitempty"`
+}
+
+type Anything struct {
+	Value interface{} `json:"-"`
+}
+
+func (in *Anything) UnmarshalJSON(val []byte) error {
+	if bytes.Equal(val, []byte("null")) {
+		return nil
+	}
+	return json.Unmarshal(val, &in.Value)
+}
+
+func (in Anything) MarshalJSON() ([]byte, error) {
+	if in.Value == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(in.Value)
+}
+
+type Code struct {
+	Engine string    `json:"engine"`
+	Source *Anything `json:"source"`
+}
+
+type Target struct {
+	Target string   `json:"target,omitempty"`
+	Rego   string   `json:"rego,omitempty" yaml:"rego,omitempty,flow"`
+	Libs   []string `json:"libs,omitempty" yaml:"libs,omitempty,flow"`
+	Code   []Code   `json:"code,omitempty"`
+}
+
+type TKSPolicyTemplateSpec struct {
+	CRD      CRD      `json:"crd,omitempty"`
+	Targets  []Target `json:"targets,omitempty"`
+	Clusters []string `json:"clusters,omitempty"`
+	Version  string   `json:"version"`
+	ToLatest []string `json:"toLatest,omitempty"`
+}
+
+// TemplateStatus defines the constraints state of ConstraintTemplate on the cluster
+type TemplateStatus struct {
+	ConstraintTemplateStatus string `json:"constraintTemplateStatus" enums:"ready,applying,deleting,error"`
+	Reason                   string `json:"reason,omitempty"`
+	LastUpdate               string `json:"lastUpdate"`
+	Version                  string `json:"version"`
+}
+
+// TKSPolicyTemplateStatus defines the observed state of TKSPolicyTemplate
+type TKSPolicyTemplateStatus struct {
+	TemplateStatus map[string]TemplateStatus `json:"templateStatus,omitempty"`
+	LastUpdate     string                    `json:"lastUpdate"`
+	UpdateQueue    map[string]bool           `json:"updateQueue,omitempty"`
+}
+
+// TKSPolicyTemplate is the Schema for the tkspolicytemplates API
+type TKSPolicyTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TKSPolicyTemplateSpec   `json:"spec,omitempty"`
+	Status TKSPolicyTemplateStatus `json:"status,omitempty"`
+}
+
+// TKSPolicyTemplateList contains a list of TKSPolicyTemplate
+type TKSPolicyTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TKSPolicyTemplate `json:"items"`
+}
+
+// ****************************************************************************************************
+// TKSPolicy
+
+type Kinds struct {
+	APIGroups []string `json:"apiGroups,omitempty" protobuf:"bytes,1,rep,name=apiGroups"`
+	Kinds     []string `json:"kinds,omitempty"`
+}
+
+type Match struct {
+	Namespaces         []string `json:"namespaces,omitempty"`
+	ExcludedNamespaces []string `json:"excludedNamespaces,omitempty"`
+	Kinds              []Kinds  `json:"kinds,omitempty"`
+}
+
+type TKSPolicySpec struct {
+	Clusters          []string              `json:"clusters"`
+	Template          string                `json:"template" validate:"required"`
+	Params            *apiextensionsv1.JSON `json:"params,omitempty"`
+	Match             *Match                `json:"match,omitempty"`
+	EnforcementAction string                `json:"enforcementAction,omitempty"`
+}
+
+// PolicyStatus defines the constraints state on the cluster
+type PolicyStatus struct {
+	ConstraintStatus string `json:"constraintStatus" enums:"ready,applying,deleting,error"`
+	Reason           string `json:"reason,omitempty"`
+	LastUpdate       string `json:"lastUpdate"`
+	TemplateVersion  string `json:"templateVersion"`
+}
+
+// TKSPolicyStatus defines the observed state of TKSPolicy
+type TKSPolicyStatus struct {
+	Clusters    map[string]PolicyStatus `json:"clusters,omitempty"`
+	LastUpdate  string                  `json:"lastUpdate"`
+	UpdateQueue map[string]bool         `json:"updateQueue,omitempty"`
+	Reason      string                  `json:"reason,omitempty"`
+}
+
+// TKSPolicy is the Schema for the tkspolicies API
+type TKSPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TKSPolicySpec   `json:"spec,omitempty"`
+	Status TKSPolicyStatus `json:"status,omitempty"`
+}
+
+// TKSPolicyList contains a list of TKSPolicy
+type TKSPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TKSPolicy `json:"items"`
+}
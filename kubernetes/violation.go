@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/client-go/dynamic"
+
+	"github.com/seungkyua/go-test/thanos/client"
+)
+
+// PolicyViolation is a TKSPolicy with its template and the live violation counts reported by Thanos
+type PolicyViolation struct {
+	Policy            string         `json:"policy"`
+	PolicyTemplateID  string         `json:"policyTemplateId,omitempty"`
+	Template          string         `json:"template"`
+	TemplateKind      string         `json:"templateKind,omitempty"`
+	EnforcementAction string         `json:"enforcementAction"`
+	Clusters          []string       `json:"clusters"`
+	Violations        map[string]int `json:"violations"`
+	TotalViolations   int            `json:"totalViolations"`
+}
+
+type constraintViolationMetric struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric struct {
+				Kind    string `json:"kind"`
+				Name    string `json:"name"`
+				Cluster string `json:"taco_cluster"`
+			} `json:"metric"`
+			Value []interface{} `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// GetPolicyViolations returns every TKSPolicy of the namespace joined with its TKSPolicyTemplate and the
+// opa_scorecard_constraint_violations of its target clusters.
+// The template is found by the tks/policy-template-id label (or Spec.Template when the label is missing) and
+// a violation belongs to the policy when its kind is the template CRD kind and its name is the policy name.
+func GetPolicyViolations(dc dynamic.Interface, namespace string, thanosClient *client.Client) ([]PolicyViolation, error) {
+	tksPolicyTemplates, err := GetTKSPolicyTemplates(dc, namespace)
+	if err != nil {
+		return nil, err
+	}
+	tksPolicies, err := GetTKSPolicies(dc, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	var clusters []string
+	for _, tksPolicy := range tksPolicies {
+		for _, cluster := range tksPolicy.Spec.Clusters {
+			if !slices.Contains(clusters, cluster) {
+				clusters = append(clusters, cluster)
+			}
+		}
+	}
+
+	metric := &constraintViolationMetric{}
+	if len(clusters) > 0 {
+		metric, err = getConstraintViolationMetric(thanosClient, clusters)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return joinPolicyViolations(tksPolicyTemplates, tksPolicies, metric), nil
+}
+
+func getConstraintViolationMetric(thanosClient *client.Client, clusters []string) (*constraintViolationMetric, error) {
+	quoted := make([]string, 0, len(clusters))
+	for _, cluster := range clusters {
+		quoted = append(quoted, regexp.QuoteMeta(cluster))
+	}
+	query := fmt.Sprintf("sum by (kind,name,taco_cluster) (opa_scorecard_constraint_violations{taco_cluster=~%q})",
+		strings.Join(quoted, "|"))
+
+	out, err := thanosClient.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("query constraint violations: %w", err)
+	}
+
+	var metric constraintViolationMetric
+	if err := json.Unmarshal(out, &metric); err != nil {
+		return nil, fmt.Errorf("unmarshal constraint violations: %w", err)
+	}
+	return &metric, nil
+}
+
+func joinPolicyViolations(tksPolicyTemplates []TKSPolicyTemplate, tksPolicies []TKSPolicy, metric *constraintViolationMetric) []PolicyViolation {
+	templatesByID := make(map[string]*TKSPolicyTemplate)
+	templatesByName := make(map[string]*TKSPolicyTemplate)
+	for i := range tksPolicyTemplates {
+		t := &tksPolicyTemplates[i]
+		if id := t.Labels["tks/policy-template-id"]; id != "" {
+			templatesByID[id] = t
+		}
+		templatesByName[t.GetName()] = t
+	}
+
+	// counts[kind][name][cluster]
+	counts := make(map[string]map[string]map[string]int)
+	for _, result := range metric.Data.Result {
+		if len(result.Value) < 2 {
+			continue
+		}
+		value, ok := result.Value[1].(string)
+		if !ok {
+			continue
+		}
+		count, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		m := result.Metric
+		if counts[m.Kind] == nil {
+			counts[m.Kind] = make(map[string]map[string]int)
+		}
+		if counts[m.Kind][m.Name] == nil {
+			counts[m.Kind][m.Name] = make(map[string]int)
+		}
+		counts[m.Kind][m.Name][m.Cluster] += int(count)
+	}
+
+	policyViolations := make([]PolicyViolation, 0, len(tksPolicies))
+	for _, tksPolicy := range tksPolicies {
+		pv := PolicyViolation{
+			Policy:            tksPolicy.GetName(),
+			PolicyTemplateID:  tksPolicy.Labels["tks/policy-template-id"],
+			Template:          tksPolicy.Spec.Template,
+			EnforcementAction: tksPolicy.Spec.EnforcementAction,
+			Clusters:          tksPolicy.Spec.Clusters,
+			Violations:        make(map[string]int, len(tksPolicy.Spec.Clusters)),
+		}
+		if pv.EnforcementAction == "" {
+			pv.EnforcementAction = "deny"
+		}
+
+		template, ok := templatesByID[pv.PolicyTemplateID]
+		if !ok {
+			template = templatesByName[tksPolicy.Spec.Template]
+		}
+		if template != nil {
+			pv.Template = template.GetName()
+			pv.TemplateKind = template.Spec.CRD.Spec.Names.Kind
+		}
+
+		for _, cluster := range tksPolicy.Spec.Clusters {
+			count := 0
+			if pv.TemplateKind != "" {
+				count = counts[pv.TemplateKind][pv.Policy][cluster]
+			} else {
+				for _, byName := range counts {
+					count += byName[pv.Policy][cluster]
+				}
+			}
+			pv.Violations[cluster] = count
+			pv.TotalViolations += count
+		}
+		policyViolations = append(policyViolations, pv)
+	}
+
+	sort.Slice(policyViolations, func(i, j int) bool {
+		return policyViolations[i].Policy < policyViolations[j].Policy
+	})
+	return policyViolations
+}
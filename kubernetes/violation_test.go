@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/seungkyua/go-test/thanos/client"
+)
+
+func TestGetPolicyViolations(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("query")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"kind":"K8sRequiredLabels","name":"p1","taco_cluster":"c1"},"value":[1700000000,"3"]},
+			{"metric":{"kind":"K8sRequiredLabels","name":"p1","taco_cluster":"c2"},"value":[1700000000,"1"]},
+			{"metric":{"kind":"K8sAllowedRepos","name":"p1","taco_cluster":"c1"},"value":[1700000000,"7"]},
+			{"metric":{"kind":"K8sAllowedRepos","name":"p2","taco_cluster":"c2"},"value":[1700000000,"5"]}
+		]}}`))
+	}))
+	defer server.Close()
+
+	labels := func(u map[string]interface{}, id string) {
+		u["metadata"].(map[string]interface{})["labels"] = map[string]interface{}{"tks/policy-template-id": id}
+	}
+	t1 := newUnstructured("TKSPolicyTemplate", "org", "k8srequiredlabels", map[string]interface{}{
+		"crd": map[string]interface{}{"spec": map[string]interface{}{"names": map[string]interface{}{"kind": "K8sRequiredLabels"}}},
+	})
+	labels(t1.Object, "t1")
+	t2 := newUnstructured("TKSPolicyTemplate", "org", "k8sallowedrepos", map[string]interface{}{
+		"crd": map[string]interface{}{"spec": map[string]interface{}{"names": map[string]interface{}{"kind": "K8sAllowedRepos"}}},
+	})
+	labels(t2.Object, "t2")
+	p1 := newUnstructured("TKSPolicy", "org", "p1", map[string]interface{}{
+		"template":          "k8srequiredlabels",
+		"clusters":          []interface{}{"c1", "c2", "c3"},
+		"enforcementAction": "warn",
+	})
+	labels(p1.Object, "t1")
+	p2 := newUnstructured("TKSPolicy", "org", "p2", map[string]interface{}{
+		"template": "k8sallowedrepos",
+		"clusters": []interface{}{"c2"},
+	})
+	dc := newFakeDynamicClient(t1, t2, p1, p2)
+
+	policyViolations, err := GetPolicyViolations(dc, "org", client.New(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if !strings.Contains(query, `taco_cluster=~"c1|c2|c3"`) {
+		t.Errorf("unexpected query (%s)", query)
+	}
+
+	want := []PolicyViolation{
+		{
+			Policy: "p1", PolicyTemplateID: "t1", Template: "k8srequiredlabels", TemplateKind: "K8sRequiredLabels",
+			EnforcementAction: "warn", Clusters: []string{"c1", "c2", "c3"},
+			Violations: map[string]int{"c1": 3, "c2": 1, "c3": 0}, TotalViolations: 4,
+		},
+		{
+			Policy: "p2", Template: "k8sallowedrepos", TemplateKind: "K8sAllowedRepos",
+			EnforcementAction: "deny", Clusters: []string{"c2"},
+			Violations: map[string]int{"c2": 5}, TotalViolations: 5,
+		},
+	}
+	if !reflect.DeepEqual(policyViolations, want) {
+		t.Errorf("want (%+v) got (%+v)", want, policyViolations)
+	}
+}
+
+func TestGetPolicyViolationsThanosError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	dc := newFakeDynamicClient(newUnstructured("TKSPolicy", "org", "p1", map[string]interface{}{
+		"template": "t1",
+		"clusters": []interface{}{"c1"},
+	}))
+	if _, err := GetPolicyViolations(dc, "org", client.New(server.URL)); err == nil {
+		t.Errorf("want error got nil")
+	}
+}
+
+func TestGetPolicyViolationsDottedCluster(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("query")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+	defer server.Close()
+
+	dc := newFakeDynamicClient(newUnstructured("TKSPolicy", "org", "p1", map[string]interface{}{
+		"template": "t1",
+		"clusters": []interface{}{"prod.c1", "c2"},
+	}))
+	if _, err := GetPolicyViolations(dc, "org", client.New(server.URL)); err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	// the regexp escape of the dot is itself escaped in the PromQL string
+	if !strings.Contains(query, `taco_cluster=~"prod\\.c1|c2"`) {
+		t.Errorf("unexpected query (%s)", query)
+	}
+}
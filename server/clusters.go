@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrUnknownOrganization is returned by a ClusterStore for an organization it has no clusters of
+var ErrUnknownOrganization = errors.New("unknown organization")
+
+// ClusterStore returns the clusters of an organization, the policy violations of an organization
+// are only served for its clusters
+type ClusterStore interface {
+	Clusters(organization string) ([]string, error)
+}
+
+// StaticClusters is a ClusterStore of a fixed mapping of the organizations to their cluster ids
+type StaticClusters map[string][]string
+
+func (c StaticClusters) Clusters(organization string) ([]string, error) {
+	clusters := c[organization]
+	if len(clusters) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownOrganization, organization)
+	}
+	return append([]string(nil), clusters...), nil
+}
+
+// LoadStaticClusters reads the cluster ids of the organizations from a JSON object such as {"org1": ["c1", "c2"]}
+func LoadStaticClusters(path string) (StaticClusters, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var clusters StaticClusters
+	if err := json.Unmarshal(data, &clusters); err != nil {
+		return nil, fmt.Errorf("invalid organization clusters %s: %w", path, err)
+	}
+	return clusters, nil
+}
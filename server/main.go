@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/seungkyua/go-test/dashboard"
+	"github.com/seungkyua/go-test/thanos/client"
+)
+
+// server exposes the organization dashboards and the policy violation charts as a REST API.
+// The API is described by GET /openapi.json.
+func main() {
+	listen := flag.String("listen", ":8080", "listen address")
+	thanosURL := flag.String("thanos-url", client.DefaultURL, "Thanos Query URL")
+	clustersFile := flag.String("organization-clusters", "",
+		`JSON file of the cluster ids of every organization, such as {"org1": ["c1", "c2"]}, the policy violations of other organizations are not served`)
+	cacheSize := flag.Int("cache-size", 1000, "number of cached Thanos responses, 0 disables the cache")
+	retries := flag.Int("retries", 3, "attempts of a Thanos query which failed with a transient error")
+	breakerFailures := flag.Int("breaker-failures", 5, "consecutive Thanos failures which open the circuit breaker, 0 disables it")
+	breakerTimeout := flag.Duration("breaker-timeout", 30*time.Second, "time the circuit breaker stays open before probing Thanos")
+	var thanosOpts client.Options
+	thanosOpts.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	thanosClient, err := client.NewWithOptions(*thanosURL, thanosOpts)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	thanosClient.Retry = client.RetryOptions{MaxAttempts: *retries}
+	if *breakerFailures > 0 {
+		thanosClient.Breaker = client.NewCircuitBreaker(*breakerFailures, *breakerTimeout)
+	}
+	if *cacheSize > 0 {
+		thanosClient.Cache = client.NewCache(client.CacheOptions{MaxEntries: *cacheSize})
+	}
+	s := &Server{
+		Dashboards: dashboard.NewMemoryStore(),
+		Thanos:     thanosClient,
+		Logger:     logger,
+	}
+	if *clustersFile != "" {
+		clusters, err := LoadStaticClusters(*clustersFile)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		s.Clusters = clusters
+	} else {
+		logger.Printf("no --organization-clusters, policy violations are not served")
+	}
+
+	httpServer := &http.Server{
+		Addr:              *listen,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      time.Minute,
+	}
+	logger.Printf("listening on %s", *listen)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Fatal(err)
+	}
+}
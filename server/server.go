@@ -0,0 +1,301 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/seungkyua/go-test/dashboard"
+	"github.com/seungkyua/go-test/thanos/client"
+	"github.com/seungkyua/go-test/thanos/metric"
+)
+
+const (
+	defaultTopN = 5
+	maxTopN     = 100
+
+	// maxBodyBytes limits the size of request bodies
+	maxBodyBytes = 1 << 20
+)
+
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// Error codes of ErrorResponse
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeNotFound         = "not_found"
+	CodeForbidden        = "forbidden"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeUpstream         = "upstream_error"
+	CodeUnavailable      = "upstream_unavailable"
+	CodeInternal         = "internal_error"
+)
+
+// ErrorResponse is the body of every error response
+type ErrorResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// Server serves the dashboard and policy violation chart API
+type Server struct {
+	Dashboards dashboard.Store
+	// Clusters scopes the policy violations of an organization to its clusters, without it none is served
+	Clusters ClusterStore
+	Thanos   *client.Client
+	Logger   *log.Logger
+}
+
+// Handler returns the routes of the server wrapped with request IDs and access logs
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/openapi.json", s.handleOpenAPI)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/organizations/", s.handleOrganization)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, fmt.Sprintf("no route for %s", r.URL.Path))
+	})
+	return withRequestID(withAccessLog(s.Logger, mux))
+}
+
+// route is an endpoint under /organizations/{org}/
+type route struct {
+	method  string
+	handler func(w http.ResponseWriter, r *http.Request, organization string)
+}
+
+// handleOrganization routes /organizations/{org}/<resource>
+func (s *Server) handleOrganization(w http.ResponseWriter, r *http.Request) {
+	organization, resource, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/organizations/"), "/")
+	resource = strings.TrimSuffix(resource, "/")
+
+	routes := map[string][]route{
+		"dashboards": {
+			{http.MethodGet, s.getDashboards},
+			{http.MethodPut, s.putDashboards},
+		},
+		"policy-violations/bar-chart": {{http.MethodGet, s.getPolicyViolationChart}},
+		"policy-violations/top":       {{http.MethodGet, s.getPolicyViolationTop}},
+		"policy-violations/log":       {{http.MethodGet, s.getPolicyViolationLog}},
+	}
+	candidates, ok := routes[resource]
+	if organization == "" || !ok {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, fmt.Sprintf("no route for %s", r.URL.Path))
+		return
+	}
+
+	allowed := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		if candidate.method == r.Method {
+			candidate.handler(w, r, organization)
+			return
+		}
+		allowed = append(allowed, candidate.method)
+	}
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, fmt.Sprintf("%s is not allowed", r.Method))
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, fmt.Sprintf("%s is not allowed", r.Method))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openAPIDocument)
+}
+
+// handleMetrics exposes the Thanos query cache counters in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, fmt.Sprintf("%s is not allowed", r.Method))
+		return
+	}
+	var stats client.CacheStats
+	if s.Thanos.Cache != nil {
+		stats = s.Thanos.Cache.Stats()
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, m := range []struct {
+		name  string
+		kind  string
+		help  string
+		value int64
+	}{
+		{"thanos_query_cache_hits_total", "counter", "Thanos queries answered from the cache.", stats.Hits},
+		{"thanos_query_cache_misses_total", "counter", "Thanos queries sent to Thanos.", stats.Misses},
+		{"thanos_query_cache_shared_total", "counter", "Thanos queries which waited for an identical query in flight.", stats.Shared},
+		{"thanos_query_cache_evictions_total", "counter", "Cached responses evicted by the size bound.", stats.Evictions},
+		{"thanos_query_cache_entries", "gauge", "Cached responses.", int64(stats.Entries)},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", m.name, m.help, m.name, m.kind, m.name, m.value)
+	}
+}
+
+func (s *Server) getDashboards(w http.ResponseWriter, r *http.Request, organization string) {
+	groups, err := s.Dashboards.Get(organization)
+	if errors.Is(err, dashboard.ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, groups)
+}
+
+func (s *Server) putDashboards(w http.ResponseWriter, r *http.Request, organization string) {
+	var groups []dashboard.CreateDashboardRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&groups); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("invalid dashboard: %s", err))
+		return
+	}
+	if err := dashboard.Validate(groups); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	if err := s.Dashboards.Put(organization, groups); err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, groups)
+}
+
+func (s *Server) getPolicyViolationChart(w http.ResponseWriter, r *http.Request, organization string) {
+	opts, ok := s.queryOptions(w, r, organization)
+	if !ok {
+		return
+	}
+	bcd, err := metric.GetPolicyViolationChart(r.Context(), s.Thanos, opts)
+	if err != nil {
+		writeUpstreamError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, bcd)
+}
+
+func (s *Server) getPolicyViolationTop(w http.ResponseWriter, r *http.Request, organization string) {
+	opts, ok := s.queryOptions(w, r, organization)
+	if !ok {
+		return
+	}
+	n := defaultTopN
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n <= 0 || n > maxTopN {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("n must be between 1 and %d", maxTopN))
+			return
+		}
+	}
+
+	bcd, err := metric.GetPolicyViolationTopChart(r.Context(), s.Thanos, opts, n)
+	if err != nil {
+		writeUpstreamError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, bcd)
+}
+
+func (s *Server) getPolicyViolationLog(w http.ResponseWriter, r *http.Request, organization string) {
+	opts, ok := s.queryOptions(w, r, organization)
+	if !ok {
+		return
+	}
+	logs, err := metric.GetPolicyViolationLog(r.Context(), s.Thanos, opts)
+	if err != nil {
+		writeUpstreamError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, logs)
+}
+
+// queryOptions reads the clusters, time and range query parameters, it writes an error response when they are invalid.
+// The clusters default to every cluster of the organization and must belong to it.
+func (s *Server) queryOptions(w http.ResponseWriter, r *http.Request, organization string) (metric.QueryOptions, bool) {
+	var opts metric.QueryOptions
+	query := r.URL.Query()
+
+	var orgClusters []string
+	err := fmt.Errorf("%w: %s", ErrUnknownOrganization, organization)
+	if s.Clusters != nil {
+		orgClusters, err = s.Clusters.Clusters(organization)
+	}
+	if errors.Is(err, ErrUnknownOrganization) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, err.Error())
+		return opts, false
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, err.Error())
+		return opts, false
+	}
+
+	for _, cluster := range strings.Split(query.Get("clusters"), ",") {
+		if cluster = strings.TrimSpace(cluster); cluster == "" {
+			continue
+		}
+		if !slices.Contains(orgClusters, cluster) {
+			writeError(w, r, http.StatusForbidden, CodeForbidden,
+				fmt.Sprintf("cluster %s does not belong to organization %s", cluster, organization))
+			return opts, false
+		}
+		opts.Clusters = append(opts.Clusters, cluster)
+	}
+	if len(opts.Clusters) == 0 {
+		opts.Clusters = orgClusters
+	}
+
+	if v := query.Get("time"); v != "" {
+		ts, err := metric.ParseTime(v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return opts, false
+		}
+		opts.Time = ts
+	}
+	if v := query.Get("range"); v != "" {
+		d, err := model.ParseDuration(v)
+		if err != nil || d <= 0 {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("invalid range %q", v))
+			return opts, false
+		}
+		opts.Range = time.Duration(d)
+	}
+	return opts, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeUpstreamError writes a failed Thanos query, 503 while the circuit breaker fails queries fast
+func writeUpstreamError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, client.ErrCircuitOpen) {
+		writeError(w, r, http.StatusServiceUnavailable, CodeUnavailable, err.Error())
+		return
+	}
+	writeError(w, r, http.StatusBadGateway, CodeUpstream, err.Error())
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, code string, message string) {
+	writeJSON(w, status, ErrorResponse{Code: code, Message: message, RequestID: requestID(r.Context())})
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seungkyua/go-test/dashboard"
+	"github.com/seungkyua/go-test/thanos/client"
+	"github.com/seungkyua/go-test/thanos/metric"
+)
+
+const dashboardBody = `[{"groupName":"정책정보","sizeX":4,"sizeY":6,"widgets":[
+	{"key":"PolicyViolateWidget","startX":1,"startY":1,"sizeX":2,"sizeY":2}]}]`
+
+var testClusters = StaticClusters{"org1": {"c1", "c2"}, "org2": {"c3"}}
+
+func newTestServer(t *testing.T, thanosHandler http.HandlerFunc) *httptest.Server {
+	thanos := httptest.NewServer(thanosHandler)
+	t.Cleanup(thanos.Close)
+
+	s := &Server{Dashboards: dashboard.NewMemoryStore(), Clusters: testClusters, Thanos: client.New(thanos.URL)}
+	server := httptest.NewServer(s.Handler())
+	t.Cleanup(server.Close)
+	return server
+}
+
+func do(t *testing.T, method string, url string, body string, header http.Header) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var out json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		t.Fatalf("response is not json - %s", err)
+	}
+	return res, out
+}
+
+func decodeError(t *testing.T, body []byte) ErrorResponse {
+	t.Helper()
+	var e ErrorResponse
+	if err := json.Unmarshal(body, &e); err != nil {
+		t.Fatalf("want ErrorResponse got (%s)", body)
+	}
+	return e
+}
+
+func TestDashboards(t *testing.T) {
+	server := newTestServer(t, nil)
+	url := server.URL + "/organizations/org1/dashboards"
+
+	res, body := do(t, http.MethodGet, url, "", nil)
+	if res.StatusCode != http.StatusNotFound || decodeError(t, body).Code != CodeNotFound {
+		t.Errorf("want 404 got (%d) %s", res.StatusCode, body)
+	}
+
+	res, body = do(t, http.MethodPut, url, dashboardBody, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("want 200 got (%d) %s", res.StatusCode, body)
+	}
+
+	res, body = do(t, http.MethodGet, url, "", nil)
+	var groups []dashboard.CreateDashboardRequest
+	if err := json.Unmarshal(body, &groups); err != nil || res.StatusCode != http.StatusOK ||
+		len(groups) != 1 || groups[0].Widgets[0].Key != "PolicyViolateWidget" {
+		t.Errorf("want stored dashboard got (%d) %s", res.StatusCode, body)
+	}
+}
+
+func TestPutDashboardsInvalid(t *testing.T) {
+	server := newTestServer(t, nil)
+	url := server.URL + "/organizations/org1/dashboards"
+
+	for _, body := range []string{
+		`{`,
+		`[{"groupName":"g","sizeX":4,"sizeY":6,"unknown":1}]`,
+		`[{"groupName":"","sizeX":4,"sizeY":6}]`,
+		`[{"groupName":"g","sizeX":4,"sizeY":6,"widgets":[{"key":"w","sizeX":0,"sizeY":1}]}]`,
+	} {
+		res, out := do(t, http.MethodPut, url, body, nil)
+		if res.StatusCode != http.StatusBadRequest || decodeError(t, out).Code != CodeInvalidRequest {
+			t.Errorf("%s: want 400 got (%d) %s", body, res.StatusCode, out)
+		}
+	}
+}
+
+func TestPolicyViolationEndpoints(t *testing.T) {
+	var queries []string
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("query")
+		queries = append(queries, query)
+		result := `{"metric":{"kind":"K8sRequiredLabels","name":"p1","violation_enforcement":"warn","taco_cluster":"c1"},"value":[1700000000,"2"]}`
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[` + result + `]}}`))
+	})
+
+	res, body := do(t, http.MethodGet, server.URL+"/organizations/org1/policy-violations/bar-chart?clusters=c1,c2&range=1h", "", nil)
+	var bcd metric.BarChartData
+	if err := json.Unmarshal(body, &bcd); err != nil || res.StatusCode != http.StatusOK ||
+		bcd.XAxis.Data[0] != "K8sRequiredLabels" || bcd.Series[1].Data[0] != 2 {
+		t.Errorf("unexpected bar chart (%d) %s", res.StatusCode, body)
+	}
+	if !strings.Contains(queries[0], `taco_cluster=~"c1|c2"`) || !strings.Contains(queries[0], "[1h]") {
+		t.Errorf("unexpected query (%s)", queries[0])
+	}
+
+	queries = nil
+	res, body = do(t, http.MethodGet, server.URL+"/organizations/org1/policy-violations/top?n=3&clusters=c1", "", nil)
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(queries[0], "topk (3,") {
+		t.Errorf("unexpected top (%d) %s %v", res.StatusCode, body, queries)
+	}
+
+	// the clusters default to the clusters of the organization
+	queries = nil
+	res, body = do(t, http.MethodGet, server.URL+"/organizations/org1/policy-violations/bar-chart", "", nil)
+	if res.StatusCode != http.StatusOK || !strings.Contains(queries[0], `taco_cluster=~"c1|c2"`) {
+		t.Errorf("unexpected bar chart (%d) %s %v", res.StatusCode, body, queries)
+	}
+
+	res, body = do(t, http.MethodGet, server.URL+"/organizations/org1/policy-violations/log?clusters=c1", "", nil)
+	var logs []metric.PolicyViolationLog
+	if err := json.Unmarshal(body, &logs); err != nil || res.StatusCode != http.StatusOK || len(logs) != 1 || logs[0].Cluster != "c1" {
+		t.Errorf("unexpected log (%d) %s", res.StatusCode, body)
+	}
+}
+
+func TestPolicyViolationErrors(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	tests := []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"/organizations/org1/policy-violations/top?clusters=c1&n=0", http.StatusBadRequest, CodeInvalidRequest},
+		{"/organizations/org1/policy-violations/log?clusters=c1&time=yesterday", http.StatusBadRequest, CodeInvalidRequest},
+		{"/organizations/org1/policy-violations/log?clusters=c1&range=1x", http.StatusBadRequest, CodeInvalidRequest},
+		{"/organizations/org1/policy-violations/bar-chart?clusters=c1", http.StatusBadGateway, CodeUpstream},
+		{"/organizations/org1/unknown", http.StatusNotFound, CodeNotFound},
+		{"/organizations//dashboards", http.StatusNotFound, CodeNotFound},
+		{"/dashboards", http.StatusNotFound, CodeNotFound},
+	}
+	for _, tt := range tests {
+		res, body := do(t, http.MethodGet, server.URL+tt.path, "", nil)
+		e := decodeError(t, body)
+		if res.StatusCode != tt.status || e.Code != tt.code {
+			t.Errorf("%s: want (%d %s) got (%d) %s", tt.path, tt.status, tt.code, res.StatusCode, body)
+		}
+		if e.RequestID == "" || e.RequestID != res.Header.Get(RequestIDHeader) {
+			t.Errorf("%s: want request id in body and header got (%s, %s)", tt.path, e.RequestID, res.Header.Get(RequestIDHeader))
+		}
+	}
+}
+
+func TestPolicyViolationOrganizationScope(t *testing.T) {
+	var queries int
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		queries++
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	})
+
+	tests := []struct {
+		path   string
+		status int
+		code   string
+	}{
+		// c3 is a cluster of org2
+		{"/organizations/org1/policy-violations/bar-chart?clusters=c3", http.StatusForbidden, CodeForbidden},
+		{"/organizations/org1/policy-violations/top?clusters=c1,c3", http.StatusForbidden, CodeForbidden},
+		{"/organizations/org1/policy-violations/log?clusters=c3", http.StatusForbidden, CodeForbidden},
+		{"/organizations/org3/policy-violations/log?clusters=c1", http.StatusNotFound, CodeNotFound},
+	}
+	for _, tt := range tests {
+		res, body := do(t, http.MethodGet, server.URL+tt.path, "", nil)
+		if e := decodeError(t, body); res.StatusCode != tt.status || e.Code != tt.code {
+			t.Errorf("%s: want (%d %s) got (%d) %s", tt.path, tt.status, tt.code, res.StatusCode, body)
+		}
+	}
+	if queries != 0 {
+		t.Errorf("want no thanos query got (%d)", queries)
+	}
+
+	// without a ClusterStore no organization is served
+	thanos := httptest.NewServer(http.NotFoundHandler())
+	defer thanos.Close()
+	unscoped := httptest.NewServer((&Server{Dashboards: dashboard.NewMemoryStore(), Thanos: client.New(thanos.URL)}).Handler())
+	defer unscoped.Close()
+	if res, body := do(t, http.MethodGet, unscoped.URL+"/organizations/org1/policy-violations/log?clusters=c1", "", nil); res.StatusCode != http.StatusNotFound {
+		t.Errorf("want 404 got (%d) %s", res.StatusCode, body)
+	}
+}
+
+func TestPolicyViolationCanceled(t *testing.T) {
+	started, canceled := make(chan struct{}), make(chan struct{})
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+		close(canceled)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/organizations/org1/policy-violations/log", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		<-started
+		cancel()
+	}()
+	if res, err := http.DefaultClient.Do(req); err == nil {
+		res.Body.Close()
+		t.Fatalf("want a canceled request got (%d)", res.StatusCode)
+	}
+
+	// the Thanos query of the handler stops with the request of the client
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the Thanos query was not canceled")
+	}
+}
+
+func TestLoadStaticClusters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clusters.json")
+	if err := os.WriteFile(path, []byte(`{"org1": ["c1", "c2"]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	clusters, err := LoadStaticClusters(path)
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if got, err := clusters.Clusters("org1"); err != nil || strings.Join(got, ",") != "c1,c2" {
+		t.Errorf("want (c1,c2) got (%v, %v)", got, err)
+	}
+	if _, err := clusters.Clusters("org2"); !errors.Is(err, ErrUnknownOrganization) {
+		t.Errorf("want ErrUnknownOrganization got (%v)", err)
+	}
+
+	if err := os.WriteFile(path, []byte(`["c1"]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadStaticClusters(path); err == nil {
+		t.Error("want error got nil")
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	server := newTestServer(t, nil)
+	res, body := do(t, http.MethodDelete, server.URL+"/organizations/org1/dashboards", "", nil)
+	if res.StatusCode != http.StatusMethodNotAllowed || res.Header.Get("Allow") != "GET, PUT" ||
+		decodeError(t, body).Code != CodeMethodNotAllowed {
+		t.Errorf("want 405 got (%d) %s", res.StatusCode, body)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	server := newTestServer(t, nil)
+
+	res, _ := do(t, http.MethodGet, server.URL+"/openapi.json", "", http.Header{RequestIDHeader: {"abc-123"}})
+	if got := res.Header.Get(RequestIDHeader); got != "abc-123" {
+		t.Errorf("want (abc-123) got (%s)", got)
+	}
+
+	res, _ = do(t, http.MethodGet, server.URL+"/openapi.json", "", http.Header{RequestIDHeader: {"bad id"}})
+	if got := res.Header.Get(RequestIDHeader); got == "" || got == "bad id" {
+		t.Errorf("want a generated request id got (%s)", got)
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	server := newTestServer(t, nil)
+	res, body := do(t, http.MethodGet, server.URL+"/openapi.json", "", nil)
+
+	var doc struct {
+		OpenAPI string                 `json:"openapi"`
+		Paths   map[string]interface{} `json:"paths"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil || res.StatusCode != http.StatusOK || doc.OpenAPI == "" {
+		t.Fatalf("unexpected document (%d) %s", res.StatusCode, body)
+	}
+	for _, path := range []string{
+		"/organizations/{org}/dashboards",
+		"/organizations/{org}/policy-violations/bar-chart",
+		"/organizations/{org}/policy-violations/top",
+		"/organizations/{org}/policy-violations/log",
+	} {
+		if _, ok := doc.Paths[path]; !ok {
+			t.Errorf("path %s is not documented", path)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	var requests int
+	thanos := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+	defer thanos.Close()
+
+	thanosClient := client.New(thanos.URL)
+	thanosClient.Cache = client.NewCache(client.CacheOptions{})
+	server := httptest.NewServer((&Server{Dashboards: dashboard.NewMemoryStore(), Clusters: testClusters, Thanos: thanosClient}).Handler())
+	defer server.Close()
+
+	for i := 0; i < 3; i++ {
+		if res, body := do(t, http.MethodGet, server.URL+"/organizations/org1/policy-violations/bar-chart?clusters=c1", "", nil); res.StatusCode != http.StatusOK {
+			t.Fatalf("want 200 got (%d) %s", res.StatusCode, body)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("want 1 thanos request got (%d)", requests)
+	}
+
+	res, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	for _, want := range []string{"thanos_query_cache_hits_total 2", "thanos_query_cache_misses_total 1"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("want %s in\n%s", want, body)
+		}
+	}
+}
+
+func TestCircuitOpen(t *testing.T) {
+	thanos := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer thanos.Close()
+
+	thanosClient := client.New(thanos.URL)
+	thanosClient.Breaker = client.NewCircuitBreaker(1, time.Hour)
+	server := httptest.NewServer((&Server{Dashboards: dashboard.NewMemoryStore(), Clusters: testClusters, Thanos: thanosClient}).Handler())
+	defer server.Close()
+
+	url := server.URL + "/organizations/org1/policy-violations/bar-chart?clusters=c1"
+	if res, body := do(t, http.MethodGet, url, "", nil); res.StatusCode != http.StatusBadGateway {
+		t.Errorf("want 502 got (%d) %s", res.StatusCode, body)
+	}
+	res, body := do(t, http.MethodGet, url, "", nil)
+	if res.StatusCode != http.StatusServiceUnavailable || decodeError(t, body).Code != CodeUnavailable {
+		t.Errorf("want 503 got (%d) %s", res.StatusCode, body)
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/spf13/pflag"
+
+	"github.com/seungkyua/go-test/thanos/client"
+	"github.com/seungkyua/go-test/thanos/metric"
+)
+
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputCSV   = "csv"
+)
+
+const cliUsage = `Usage: thanos-policy <command> [flags]
+
+Commands:
+  violations summary        violations of every policy template by enforcement action
+  violations top            the --n policy templates with the most violations
+  violations log            resources violating a policy
+  workloads                 number of deployments with available replicas
+  query <promql>            run a PromQL query, a range query with --range
+
+Flags:
+`
+
+// errUsage is returned for invalid command lines, the usage is printed with the error
+var errUsage = errors.New("invalid usage")
+
+type cli struct {
+	out    io.Writer
+	errOut io.Writer
+
+	clusters  []string
+	thanosURL string
+	timeFlag  string
+	rangeFlag string
+	step      time.Duration
+	n         int
+	output    string
+	retries   int
+
+	thanosOpts client.Options
+}
+
+func newCLI(out io.Writer, errOut io.Writer) *cli {
+	return &cli{out: out, errOut: errOut}
+}
+
+func (c *cli) flagSet() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("thanos-policy", pflag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringSliceVar(&c.clusters, "clusters", nil, "comma separated cluster ids (taco_cluster)")
+	flags.StringVar(&c.thanosURL, "thanos-url", client.DefaultURL, "Thanos Query URL")
+	flags.StringVar(&c.timeFlag, "time", "", "evaluation time, RFC3339 or unix seconds (default now)")
+	flags.StringVar(&c.rangeFlag, "range", "", "time range ending at --time, e.g. 1h or 7d")
+	flags.DurationVar(&c.step, "step", 0, "query: resolution of a range query (default range/60)")
+	flags.IntVar(&c.n, "n", 5, "violations top: number of policy templates")
+	flags.StringVarP(&c.output, "output", "o", OutputTable, "output format: table, json or csv")
+	flags.IntVar(&c.retries, "retries", 3, "attempts of a query which failed with a transient Thanos error")
+
+	authFlags := flag.NewFlagSet("thanos-policy", flag.ContinueOnError)
+	c.thanosOpts.RegisterFlags(authFlags)
+	flags.AddGoFlagSet(authFlags)
+	return flags
+}
+
+// run parses args and executes the command. Flags may be given before or after the command.
+func (c *cli) run(args []string) error {
+	flags := c.flagSet()
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, pflag.ErrHelp) {
+			c.usage(flags)
+			return nil
+		}
+		return fmt.Errorf("%w: %s", errUsage, err)
+	}
+	switch c.output {
+	case OutputTable, OutputJSON, OutputCSV:
+	default:
+		return fmt.Errorf("%w: unknown output format %q", errUsage, c.output)
+	}
+
+	opts, err := c.queryOptions()
+	if err != nil {
+		return err
+	}
+	thanosClient, err := client.NewWithOptions(c.thanosURL, c.thanosOpts)
+	if err != nil {
+		return err
+	}
+	thanosClient.Retry = client.RetryOptions{MaxAttempts: c.retries}
+
+	cmd := flags.Args()
+	if len(cmd) == 0 {
+		return fmt.Errorf("%w: missing command", errUsage)
+	}
+	if cmd[0] == "query" {
+		if len(cmd) != 2 {
+			return fmt.Errorf("%w: query takes one PromQL expression", errUsage)
+		}
+		return c.query(thanosClient, cmd[1], opts)
+	}
+	if len(opts.Clusters) == 0 {
+		return fmt.Errorf("%w: --clusters is required", errUsage)
+	}
+
+	ctx := context.Background()
+	switch strings.Join(cmd, " ") {
+	case "violations summary":
+		bcd, err := metric.GetPolicyViolationChart(ctx, thanosClient, opts)
+		if err != nil {
+			return err
+		}
+		return c.printBarChartData(bcd)
+	case "violations top":
+		if c.n <= 0 {
+			return fmt.Errorf("%w: --n must be positive", errUsage)
+		}
+		bcd, err := metric.GetPolicyViolationTopChart(ctx, thanosClient, opts, c.n)
+		if err != nil {
+			return err
+		}
+		return c.printBarChartData(bcd)
+	case "violations log":
+		logs, err := metric.GetPolicyViolationLog(ctx, thanosClient, opts)
+		if err != nil {
+			return err
+		}
+		return c.print(logs, []string{"CLUSTER", "POLICY TEMPLATE", "POLICY", "ENFORCEMENT", "KIND", "NAMESPACE", "NAME", "MESSAGE"},
+			func() [][]string {
+				rows := make([][]string, 0, len(logs))
+				for _, l := range logs {
+					rows = append(rows, []string{l.Cluster, l.PolicyTemplate, l.Policy, l.EnforcementAction,
+						l.ViolatingKind, l.ViolatingNamespace, l.ViolatingName, l.Message})
+				}
+				return rows
+			})
+	case "workloads":
+		count, err := metric.GetWorkloadCount(ctx, thanosClient, opts)
+		if err != nil {
+			return err
+		}
+		v := struct {
+			Clusters  []string `json:"clusters"`
+			Workloads int      `json:"workloads"`
+		}{opts.Clusters, count}
+		return c.print(v, []string{"CLUSTERS", "WORKLOADS"}, func() [][]string {
+			return [][]string{{strings.Join(opts.Clusters, ","), strconv.Itoa(count)}}
+		})
+	}
+	return fmt.Errorf("%w: unknown command %q", errUsage, strings.Join(cmd, " "))
+}
+
+func (c *cli) usage(flags *pflag.FlagSet) {
+	fmt.Fprint(c.errOut, cliUsage)
+	fmt.Fprint(c.errOut, flags.FlagUsages())
+}
+
+func (c *cli) queryOptions() (metric.QueryOptions, error) {
+	opts := metric.QueryOptions{Clusters: c.clusters}
+	if c.timeFlag != "" {
+		ts, err := metric.ParseTime(c.timeFlag)
+		if err != nil {
+			return opts, fmt.Errorf("%w: invalid --time %q", errUsage, c.timeFlag)
+		}
+		opts.Time = ts
+	}
+	if c.rangeFlag != "" {
+		r, err := model.ParseDuration(c.rangeFlag)
+		if err != nil || r <= 0 {
+			return opts, fmt.Errorf("%w: invalid --range %q", errUsage, c.rangeFlag)
+		}
+		opts.Range = time.Duration(r)
+	}
+	return opts, nil
+}
+
+// query runs a raw PromQL expression. JSON output is the Thanos response as is.
+func (c *cli) query(thanosClient *client.Client, query string, opts metric.QueryOptions) error {
+	var body []byte
+	var err error
+	if opts.Range > 0 {
+		end := opts.Time
+		if end.IsZero() {
+			end = time.Now()
+		}
+		step := c.step
+		if step <= 0 {
+			step = max(opts.Range/60, time.Second)
+		}
+		body, err = thanosClient.QueryRange(query, end.Add(-opts.Range), end, step)
+	} else {
+		body, err = thanosClient.QueryAt(query, opts.Time)
+	}
+	if err != nil {
+		return fmt.Errorf("query %s: %w", query, err)
+	}
+
+	if c.output == OutputJSON {
+		_, err := fmt.Fprintf(c.out, "%s\n", strings.TrimSpace(string(body)))
+		return err
+	}
+	header, rows, err := queryRows(body)
+	if err != nil {
+		return err
+	}
+	return c.print(nil, header, func() [][]string { return rows })
+}
+
+type queryResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+type querySeries struct {
+	Metric map[string]string `json:"metric"`
+	Value  []interface{}     `json:"value"`
+	Values [][]interface{}   `json:"values"`
+}
+
+// queryRows flattens a vector, matrix or scalar result into one row per sample:
+// the label values of the series, the sample time and the sample value.
+func queryRows(body []byte) ([]string, [][]string, error) {
+	var res queryResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, nil, fmt.Errorf("unmarshal query result: %w", err)
+	}
+
+	var series []querySeries
+	switch res.Data.ResultType {
+	case "vector", "matrix":
+		if err := json.Unmarshal(res.Data.Result, &series); err != nil {
+			return nil, nil, fmt.Errorf("unmarshal query result: %w", err)
+		}
+	case "scalar", "string":
+		var value []interface{}
+		if err := json.Unmarshal(res.Data.Result, &value); err != nil {
+			return nil, nil, fmt.Errorf("unmarshal query result: %w", err)
+		}
+		series = []querySeries{{Value: value}}
+	default:
+		return nil, nil, fmt.Errorf("unsupported result type %q", res.Data.ResultType)
+	}
+
+	labelSet := make(map[string]bool)
+	for _, s := range series {
+		for name := range s.Metric {
+			labelSet[name] = true
+		}
+	}
+	labels := make([]string, 0, len(labelSet))
+	for name := range labelSet {
+		labels = append(labels, name)
+	}
+	sort.Strings(labels)
+
+	var rows [][]string
+	for _, s := range series {
+		samples := s.Values
+		if s.Value != nil {
+			samples = [][]interface{}{s.Value}
+		}
+		for _, sample := range samples {
+			if len(sample) != 2 {
+				continue
+			}
+			row := make([]string, 0, len(labels)+2)
+			for _, name := range labels {
+				row = append(row, s.Metric[name])
+			}
+			ts, _ := sample[0].(float64)
+			row = append(row, time.UnixMilli(int64(math.Round(ts*1000))).UTC().Format(time.RFC3339), fmt.Sprint(sample[1]))
+			rows = append(rows, row)
+		}
+	}
+	return append(labels, "TIME", "VALUE"), rows, nil
+}
+
+// printBarChartData prints one row per policy template with a column per series
+func (c *cli) printBarChartData(bcd *metric.BarChartData) error {
+	header := []string{"POLICY TEMPLATE"}
+	for _, s := range bcd.Series {
+		header = append(header, s.Name)
+	}
+	return c.print(bcd, header, func() [][]string {
+		var rows [][]string
+		if bcd.XAxis == nil {
+			return rows
+		}
+		for i, x := range bcd.XAxis.Data {
+			row := []string{x}
+			for _, s := range bcd.Series {
+				row = append(row, strconv.Itoa(s.Data[i]))
+			}
+			rows = append(rows, row)
+		}
+		return rows
+	})
+}
+
+// print writes v as JSON, or the rows built by tableRows as a table or CSV.
+func (c *cli) print(v interface{}, header []string, tableRows func() [][]string) error {
+	switch c.output {
+	case OutputJSON:
+		out, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(c.out, "%s\n", out)
+		return err
+	case OutputCSV:
+		w := csv.NewWriter(c.out)
+		if err := w.Write(header); err != nil {
+			return err
+		}
+		if err := w.WriteAll(tableRows()); err != nil {
+			return err
+		}
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range tableRows() {
+		for i := range row {
+			if row[i] == "" {
+				row[i] = "-"
+			}
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
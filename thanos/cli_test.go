@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/seungkyua/go-test/thanos/metric"
+)
+
+const vectorResult = `{"status":"success","data":{"resultType":"vector","result":[%s]}}`
+
+// newThanosServer answers the queries containing a key of responses with its vector result
+func newThanosServer(t *testing.T, responses map[string]string) (*httptest.Server, *[]string) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("query")
+		queries = append(queries, query)
+		for key, result := range responses {
+			if strings.Contains(query, key) {
+				_, _ = w.Write([]byte(strings.Replace(vectorResult, "%s", result, 1)))
+				return
+			}
+		}
+		t.Errorf("unexpected query (%s)", query)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	t.Cleanup(server.Close)
+	return server, &queries
+}
+
+func runCLI(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	err := newCLI(&out, &bytes.Buffer{}).run(args)
+	return out.String(), err
+}
+
+func TestViolationsSummary(t *testing.T) {
+	server, queries := newThanosServer(t, map[string]string{
+		"sum by (kind,name,violation_enforcement)": `
+			{"metric":{"kind":"K8sRequiredLabels","name":"p1","violation_enforcement":"warn"},"value":[1700000000,"2"]},
+			{"metric":{"kind":"K8sAllowedRepos","name":"p2"},"value":[1700000000,"3"]},
+			{"metric":{"kind":"K8sRequiredLabels","name":"p3","violation_enforcement":"dryrun"},"value":[1700000000,"1"]},
+			{"metric":{"kind":"K8sRequiredLabels","name":"p4","violation_enforcement":"warn"},"value":[1700000000,"4"]}`,
+	})
+
+	out, err := runCLI(t, "violations", "summary", "--clusters", "c1,c2", "--thanos-url", server.URL, "-o", "json", "--range", "1h")
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	var bcd metric.BarChartData
+	if err := json.Unmarshal([]byte(out), &bcd); err != nil {
+		t.Fatalf("want BarChartData json got (%s)", out)
+	}
+	want := metric.BarChartData{
+		XAxis: &metric.Axis{Data: []string{"K8sRequiredLabels", "K8sAllowedRepos"}},
+		Series: []metric.UnitNumber{
+			{Name: "거부", Data: []int{0, 3}},
+			{Name: "경고", Data: []int{6, 0}},
+			{Name: "감사", Data: []int{1, 0}},
+		},
+	}
+	if !reflect.DeepEqual(bcd, want) {
+		t.Errorf("want (%+v) got (%+v)", want, bcd)
+	}
+	if want := `max_over_time(opa_scorecard_constraint_violations{taco_cluster=~"c1|c2"}[1h])`; !strings.Contains((*queries)[0], want) {
+		t.Errorf("want %s in (%s)", want, (*queries)[0])
+	}
+}
+
+func TestViolationsTop(t *testing.T) {
+	server, queries := newThanosServer(t, map[string]string{
+		"topk (2,": `
+			{"metric":{"kind":"K8sAllowedRepos"},"value":[1700000000,"3"]},
+			{"metric":{"kind":"K8sRequiredLabels"},"value":[1700000000,"7"]}`,
+		`kind="K8sRequiredLabels"`: `
+			{"metric":{},"value":[1700000000,"5"]},
+			{"metric":{"violation_enforcement":"warn"},"value":[1700000000,"2"]}`,
+		`kind="K8sAllowedRepos"`: `{"metric":{"violation_enforcement":"dryrun"},"value":[1700000000,"3"]}`,
+	})
+
+	out, err := runCLI(t, "violations", "top", "--n", "2", "--clusters", "c3", "--thanos-url", server.URL, "-o", "csv")
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	want := "POLICY TEMPLATE,거부,경고,감사\nK8sRequiredLabels,5,2,0\nK8sAllowedRepos,0,0,3\n"
+	if out != want {
+		t.Errorf("want (%s) got (%s)", want, out)
+	}
+	if len(*queries) != 3 {
+		t.Errorf("want 3 queries got (%v)", *queries)
+	}
+}
+
+func TestViolationsLog(t *testing.T) {
+	server, _ := newThanosServer(t, map[string]string{
+		"group(": `
+			{"metric":{"taco_cluster":"c2","kind":"K8sRequiredLabels","name":"p1","violating_kind":"Pod",
+				"violating_namespace":"default","violating_name":"nginx","violation_msg":"missing labels"},"value":[1700000000,"1"]},
+			{"metric":{"taco_cluster":"c1","kind":"K8sRequiredLabels","name":"p1","violation_enforcement":"warn",
+				"violating_kind":"Namespace","violating_name":"dev","violation_msg":"missing owner"},"value":[1700000000,"1"]}`,
+	})
+
+	out, err := runCLI(t, "violations", "log", "--clusters", "c1,c2", "--thanos-url", server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "c1") || !strings.Contains(lines[1], "missing owner") ||
+		!strings.Contains(lines[2], "deny") || !strings.Contains(lines[2], "default") {
+		t.Errorf("unexpected log table\n%s", out)
+	}
+}
+
+func TestWorkloads(t *testing.T) {
+	server, _ := newThanosServer(t, map[string]string{
+		"kube_deployment_status_replicas_available": `{"metric":{},"value":[1700000000,"12"]}`,
+	})
+
+	out, err := runCLI(t, "workloads", "--clusters", "c3,c5", "--thanos-url", server.URL, "-o", "json")
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if !strings.Contains(out, `"workloads": 12`) {
+		t.Errorf("unexpected output (%s)", out)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	server, _ := newThanosServer(t, map[string]string{
+		"up": `{"metric":{"job":"b","instance":"i1"},"value":[1700000000,"1"]},{"metric":{"job":"a"},"value":[1700000000,"0"]}`,
+	})
+
+	out, err := runCLI(t, "query", "up", "--thanos-url", server.URL, "--time", "2023-11-14T22:13:20Z", "-o", "csv")
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	want := "instance,job,TIME,VALUE\ni1,b,2023-11-14T22:13:20Z,1\n,a,2023-11-14T22:13:20Z,0\n"
+	if out != want {
+		t.Errorf("want (%s) got (%s)", want, out)
+	}
+}
+
+func TestCLIUsageErrors(t *testing.T) {
+	tests := [][]string{
+		{},
+		{"violations", "summary"},
+		{"violations", "list", "--clusters", "c1"},
+		{"violations", "top", "--clusters", "c1", "--n", "0"},
+		{"workloads", "--clusters", "c1", "-o", "yaml"},
+		{"workloads", "--clusters", "c1", "--range", "1x"},
+		{"workloads", "--clusters", "c1", "--time", "yesterday"},
+		{"query"},
+	}
+	for _, args := range tests {
+		if _, err := runCLI(t, args...); !errors.Is(err, errUsage) {
+			t.Errorf("%v: want (%v) got (%v)", args, errUsage, err)
+		}
+	}
+}
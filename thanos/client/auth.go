@@ -0,0 +1,231 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options configures how a Client authenticates to Thanos Query, typically behind an auth proxy
+type Options struct {
+	// BearerToken is sent as "Authorization: Bearer <token>"
+	BearerToken string
+	// BearerTokenFile is read for the bearer token instead of BearerToken.
+	// The file is read again when it changes, so rotated tokens are picked up.
+	BearerTokenFile string
+
+	// Username and Password are sent as basic auth, PasswordFile is read instead of Password when set
+	Username     string
+	Password     string
+	PasswordFile string
+
+	// Headers are added to every request, e.g. X-Scope-OrgID of a multi-tenant setup
+	Headers map[string]string
+
+	TLS TLSOptions
+}
+
+// TLSOptions configures the TLS connection to Thanos
+type TLSOptions struct {
+	// CAFile verifies the server certificate instead of the system roots
+	CAFile string
+	// CertFile and KeyFile are the client certificate
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the host name which the server certificate is verified against
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// RegisterFlags adds the thanos-* authentication flags to fs
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.BearerTokenFile, "thanos-token-file", "", "file with the bearer token of Thanos, read again when it changes")
+	fs.StringVar(&o.Username, "thanos-username", "", "basic auth username of Thanos")
+	fs.StringVar(&o.PasswordFile, "thanos-password-file", "", "file with the basic auth password of Thanos")
+	fs.Var((*headerValue)(&o.Headers), "thanos-header", "header added to Thanos requests as name=value, may be repeated")
+	fs.StringVar(&o.TLS.CAFile, "thanos-ca-file", "", "CA certificates which verify the Thanos server certificate")
+	fs.StringVar(&o.TLS.CertFile, "thanos-cert-file", "", "client certificate for Thanos")
+	fs.StringVar(&o.TLS.KeyFile, "thanos-key-file", "", "client certificate key for Thanos")
+	fs.BoolVar(&o.TLS.InsecureSkipVerify, "thanos-insecure-skip-verify", false, "do not verify the Thanos server certificate")
+}
+
+// NewWithOptions returns a client which authenticates to Thanos as configured by opts
+func NewWithOptions(thanosUrl string, opts Options) (*Client, error) {
+	if opts.BearerToken != "" && opts.BearerTokenFile != "" {
+		return nil, errors.New("only one of bearer token and bearer token file may be set")
+	}
+	if (opts.BearerToken != "" || opts.BearerTokenFile != "") && opts.Username != "" {
+		return nil, errors.New("only one of bearer token and basic auth may be set")
+	}
+	if opts.Password != "" && opts.PasswordFile != "" {
+		return nil, errors.New("only one of password and password file may be set")
+	}
+	if (opts.TLS.CertFile == "") != (opts.TLS.KeyFile == "") {
+		return nil, errors.New("client certificate and key must be set together")
+	}
+
+	u, err := url.Parse(thanosUrl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Thanos URL: %w", err)
+	}
+	tlsConfig, err := opts.TLS.config()
+	if err != nil {
+		return nil, err
+	}
+	rt := &authRoundTripper{
+		host:     u.Host,
+		opts:     opts,
+		token:    &fileCache{path: opts.BearerTokenFile},
+		password: &fileCache{path: opts.PasswordFile},
+		next:     &http.Transport{MaxIdleConns: 10, TLSClientConfig: tlsConfig},
+	}
+	// fail early on unreadable secrets
+	if _, err := rt.token.read(); err != nil {
+		return nil, err
+	}
+	if _, err := rt.password.read(); err != nil {
+		return nil, err
+	}
+
+	c := New(thanosUrl)
+	c.HTTPClient.Transport = rt
+	return c, nil
+}
+
+func (o TLSOptions) config() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in CA file %s", o.CAFile)
+		}
+	}
+	if o.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// authRoundTripper adds the credentials and headers of opts to the requests to the Thanos host,
+// requests to other hosts such as the target of a redirect are sent without them
+type authRoundTripper struct {
+	host     string
+	opts     Options
+	token    *fileCache
+	password *fileCache
+	next     http.RoundTripper
+}
+
+func (rt *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != rt.host {
+		return rt.next.RoundTrip(req)
+	}
+	// a RoundTripper must not modify the request of the caller
+	req = req.Clone(req.Context())
+	for name, value := range rt.opts.Headers {
+		req.Header.Set(name, value)
+	}
+
+	token, err := rt.token.read()
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		token = rt.opts.BearerToken
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	if rt.opts.Username != "" {
+		password, err := rt.password.read()
+		if err != nil {
+			return nil, err
+		}
+		if password == "" {
+			password = rt.opts.Password
+		}
+		req.SetBasicAuth(rt.opts.Username, password)
+	}
+	return rt.next.RoundTrip(req)
+}
+
+// fileCache reads a secret file again when its modification time or size changes.
+// An empty path reads as an empty secret.
+type fileCache struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	value   string
+}
+
+func (f *fileCache) read() (string, error) {
+	if f.path == "" {
+		return "", nil
+	}
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.value, nil
+	}
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", err
+	}
+	f.modTime, f.size, f.value = info.ModTime(), info.Size(), strings.TrimSpace(string(b))
+	return f.value, nil
+}
+
+// headerValue is a repeatable name=value flag
+type headerValue map[string]string
+
+func (h *headerValue) String() string {
+	if h == nil {
+		return ""
+	}
+	headers := make([]string, 0, len(*h))
+	for name, value := range *h {
+		headers = append(headers, name+"="+value)
+	}
+	sort.Strings(headers)
+	return strings.Join(headers, ",")
+}
+
+func (h *headerValue) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if name = strings.TrimSpace(name); !ok || name == "" {
+		return fmt.Errorf("header %q is not name=value", s)
+	}
+	if *h == nil {
+		*h = make(map[string]string)
+	}
+	(*h)[name] = strings.TrimSpace(value)
+	return nil
+}
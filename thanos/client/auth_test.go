@@ -0,0 +1,232 @@
+package client_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/seungkyua/go-test/thanos/client"
+)
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newClientCertificate returns a self-signed client certificate and its key in PEM
+func newClientCertificate(t *testing.T) (*x509.Certificate, []byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "thanos-client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestClientHeaders(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		_, _ = w.Write([]byte(`{"status":"success"}`))
+	}))
+	defer server.Close()
+
+	c, err := client.NewWithOptions(server.URL, client.Options{
+		Username: "admin",
+		Password: "secret",
+		Headers:  map[string]string{"X-Scope-OrgID": "tenant-a"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Query("up"); err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if got.Get("X-Scope-OrgID") != "tenant-a" || got.Get("Authorization") != "Basic YWRtaW46c2VjcmV0" {
+		t.Errorf("unexpected headers (%v)", got)
+	}
+}
+
+func TestClientRedirectWithoutCredentials(t *testing.T) {
+	var got http.Header
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		_, _ = w.Write([]byte(`{"status":"success"}`))
+	}))
+	defer other.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0ken" {
+			t.Errorf("unexpected headers (%v)", r.Header)
+		}
+		http.Redirect(w, r, other.URL+r.URL.RequestURI(), http.StatusFound)
+	}))
+	defer server.Close()
+
+	c, err := client.NewWithOptions(server.URL, client.Options{
+		BearerToken: "t0ken",
+		Headers:     map[string]string{"X-Scope-OrgID": "tenant-a"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Query("up"); err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	// the credentials of Thanos are not sent to the host of the redirect
+	if got == nil || got.Get("Authorization") != "" || got.Get("X-Scope-OrgID") != "" {
+		t.Errorf("unexpected headers (%v)", got)
+	}
+}
+
+func TestClientBearerTokenFile(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`{"status":"success"}`))
+	}))
+	defer server.Close()
+
+	tokenFile := writeFile(t, "token", []byte("token-1\n"))
+	c, err := client.NewWithOptions(server.URL, client.Options{BearerTokenFile: tokenFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Query("up"); err != nil || got != "Bearer token-1" {
+		t.Fatalf("want (Bearer token-1) got (%s, %v)", got, err)
+	}
+
+	// rotate the token
+	if err := os.WriteFile(tokenFile, []byte("token-22\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Query("up"); err != nil || got != "Bearer token-22" {
+		t.Errorf("want (Bearer token-22) got (%s, %v)", got, err)
+	}
+
+	if err := os.Remove(tokenFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Query("up"); err == nil {
+		t.Error("want error for a removed token file got nil")
+	}
+}
+
+func TestClientTLS(t *testing.T) {
+	clientCert, certPEM, keyPEM := newClientCertificate(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"success"}`))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := writeFile(t, "ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	opts := client.Options{
+		BearerToken: "token",
+		TLS: client.TLSOptions{
+			CAFile:   caFile,
+			CertFile: writeFile(t, "cert.pem", certPEM),
+			KeyFile:  writeFile(t, "key.pem", keyPEM),
+		},
+	}
+	c, err := client.NewWithOptions(server.URL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Query("up"); err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+
+	// without the client certificate the handshake fails
+	opts.TLS.CertFile, opts.TLS.KeyFile = "", ""
+	if c, err = client.NewWithOptions(server.URL, opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Query("up"); err == nil {
+		t.Error("want handshake error got nil")
+	}
+
+	// without the CA the server certificate is not trusted
+	if c, err = client.NewWithOptions(server.URL, client.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Query("up"); err == nil {
+		t.Error("want certificate error got nil")
+	}
+}
+
+func TestNewWithOptionsInvalid(t *testing.T) {
+	for _, opts := range []client.Options{
+		{BearerToken: "a", BearerTokenFile: "b"},
+		{BearerToken: "a", Username: "u"},
+		{BearerTokenFile: filepath.Join(t.TempDir(), "missing")},
+		{TLS: client.TLSOptions{CertFile: "cert.pem"}},
+		{TLS: client.TLSOptions{CAFile: writeFile(t, "ca.pem", []byte("not a certificate"))}},
+	} {
+		if _, err := client.NewWithOptions("https://thanos", opts); err == nil {
+			t.Errorf("%+v: want error got nil", opts)
+		}
+	}
+}
+
+func TestOptionsRegisterFlags(t *testing.T) {
+	var opts client.Options
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	opts.RegisterFlags(fs)
+	err := fs.Parse([]string{"--thanos-header", "X-Scope-OrgID=tenant-a", "--thanos-header", "X-A = b", "--thanos-token-file", "/token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Headers["X-Scope-OrgID"] != "tenant-a" || opts.Headers["X-A"] != "b" || opts.BearerTokenFile != "/token" {
+		t.Errorf("unexpected options (%+v)", opts)
+	}
+	if err := fs.Parse([]string{"--thanos-header", "novalue"}); err == nil {
+		t.Error("want error got nil")
+	}
+}
@@ -0,0 +1,291 @@
+package client
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// QueryClass decides how long a cached response is fresh
+type QueryClass string
+
+const (
+	// QueryClassLive is an instant query evaluated at the current time
+	QueryClassLive QueryClass = "live"
+	// QueryClassHistorical is an instant query evaluated at an explicit time
+	QueryClassHistorical QueryClass = "historical"
+	// QueryClassRange is a range query
+	QueryClassRange QueryClass = "range"
+)
+
+var defaultCacheTTL = map[QueryClass]time.Duration{
+	QueryClassLive:       30 * time.Second,
+	QueryClassHistorical: 10 * time.Minute,
+	QueryClassRange:      time.Minute,
+}
+
+type CacheOptions struct {
+	// MaxEntries bounds the number of cached responses, the least recently used is evicted (default 1000)
+	MaxEntries int
+	// Bucket truncates evaluation times so that queries within the same bucket share a response (default 30s)
+	Bucket time.Duration
+	// TTL overrides the default TTL of a query class (live 30s, historical 10m, range 1m), zero disables caching
+	TTL map[QueryClass]time.Duration
+}
+
+// CacheStats counts the lookups of a Cache.
+// Shared are the lookups which waited for an identical query in flight instead of calling Thanos.
+type CacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Shared    int64 `json:"shared"`
+	Evictions int64 `json:"evictions"`
+	Entries   int   `json:"entries"`
+}
+
+// Cache keeps Thanos responses keyed by normalized query, evaluation time bucket and cluster scope.
+// Concurrent identical queries are sent once, a caller whose context is done stops waiting without failing the others.
+// Errors are not cached.
+// Cached bodies are shared between callers and must not be modified.
+type Cache struct {
+	maxEntries int
+	bucket     time.Duration
+	ttl        map[QueryClass]time.Duration
+	now        func() time.Time
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	calls   map[string]*call
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	shared    atomic.Int64
+	evictions atomic.Int64
+}
+
+var errFetchAborted = errors.New("thanos query aborted")
+
+type cacheEntry struct {
+	key     string
+	body    []byte
+	expires time.Time
+}
+
+// call is a query in flight, callers counts the callers still waiting for it
+type call struct {
+	done    chan struct{}
+	body    []byte
+	err     error
+	callers int
+	cancel  context.CancelFunc
+}
+
+func NewCache(opts CacheOptions) *Cache {
+	c := &Cache{
+		maxEntries: opts.MaxEntries,
+		bucket:     opts.Bucket,
+		ttl:        make(map[QueryClass]time.Duration),
+		now:        time.Now,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+		calls:      make(map[string]*call),
+	}
+	if c.maxEntries <= 0 {
+		c.maxEntries = 1000
+	}
+	if c.bucket <= 0 {
+		c.bucket = 30 * time.Second
+	}
+	for class, ttl := range defaultCacheTTL {
+		c.ttl[class] = ttl
+	}
+	for class, ttl := range opts.TTL {
+		c.ttl[class] = ttl
+	}
+	return c
+}
+
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	entries := c.lru.Len()
+	c.mu.Unlock()
+
+	return CacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Shared:    c.shared.Load(),
+		Evictions: c.evictions.Load(),
+		Entries:   entries,
+	}
+}
+
+// do returns the cached response of key or calls fetch once for all the concurrent callers of key.
+// fetch gets the values but not the cancellation of the context of the caller which started it,
+// so that a canceled caller does not fail the others: a caller stops waiting when its ctx is done,
+// and fetch is canceled once every caller has stopped waiting.
+func (c *Cache) do(ctx context.Context, key string, class QueryClass, fetch func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		if c.now().Before(entry.expires) {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			c.hits.Add(1)
+			return entry.body, nil
+		}
+		c.lru.Remove(el)
+		delete(c.entries, key)
+	}
+	cl, ok := c.calls[key]
+	if ok {
+		cl.callers++
+		c.mu.Unlock()
+		c.shared.Add(1)
+	} else {
+		fetchCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		cl = &call{done: make(chan struct{}), callers: 1, cancel: cancel}
+		c.calls[key] = cl
+		c.mu.Unlock()
+		c.misses.Add(1)
+		go c.fetch(fetchCtx, key, class, cl, fetch)
+	}
+
+	select {
+	case <-cl.done:
+		return cl.body, cl.err
+	case <-ctx.Done():
+		c.abandon(key, cl)
+		return nil, ctx.Err()
+	}
+}
+
+// fetch runs the fetch of cl and caches its response
+func (c *Cache) fetch(ctx context.Context, key string, class QueryClass, cl *call, fetch func(ctx context.Context) ([]byte, error)) {
+	defer func() {
+		// a panic of fetch is reported to the callers instead of crashing the process
+		if r := recover(); r != nil {
+			cl.body, cl.err = nil, fmt.Errorf("%w: %v", errFetchAborted, r)
+		}
+		cl.cancel()
+		c.mu.Lock()
+		if c.calls[key] == cl {
+			delete(c.calls, key)
+		}
+		if cl.err == nil && c.ttl[class] > 0 {
+			c.add(key, cl.body, c.ttl[class])
+		}
+		c.mu.Unlock()
+		close(cl.done)
+	}()
+	cl.body, cl.err = fetch(ctx)
+}
+
+// abandon stops waiting for cl, the last caller cancels it and lets the next caller of key start a new one
+func (c *Cache) abandon(key string, cl *call) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cl.callers--; cl.callers == 0 {
+		cl.cancel()
+		if c.calls[key] == cl {
+			delete(c.calls, key)
+		}
+	}
+}
+
+// add stores a response, c.mu must be held
+func (c *Cache) add(key string, body []byte, ttl time.Duration) {
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, body: body, expires: c.now().Add(ttl)})
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+		c.evictions.Add(1)
+	}
+}
+
+// instantKey is the key of an instant query, a zero ts is evaluated now
+func (c *Cache) instantKey(query string, ts time.Time) (string, QueryClass) {
+	class := QueryClassHistorical
+	if ts.IsZero() {
+		class = QueryClassLive
+		ts = c.now()
+	}
+	normalized, scope := normalizeQuery(query)
+	return fmt.Sprintf("query\x00%s\x00%d\x00%s", normalized, ts.Truncate(c.bucket).UnixMilli(), scope), class
+}
+
+func (c *Cache) rangeKey(query string, start time.Time, end time.Time, step time.Duration) (string, QueryClass) {
+	normalized, scope := normalizeQuery(query)
+	return fmt.Sprintf("query_range\x00%s\x00%d\x00%d\x00%d\x00%s", normalized,
+		start.Truncate(c.bucket).UnixMilli(), end.Truncate(c.bucket).UnixMilli(), step.Milliseconds(), scope), QueryClassRange
+}
+
+var clusterMatcherPattern = regexp.MustCompile(`taco_cluster\s*(=~|!~|!=|=)\s*("(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*')`)
+
+// normalizeQuery returns the query with canonical spacing and the cluster scope of its taco_cluster matchers.
+// The value of a matcher is moved to the scope and replaced by a placeholder in the query. The alternatives
+// of a regexp matcher are sorted, so that taco_cluster=~"c2|c1" and taco_cluster=~'c1|c2' share a key,
+// while the value of an equality matcher is a single cluster name which is kept as is.
+func normalizeQuery(query string) (string, string) {
+	var scopes []string
+	query = clusterMatcherPattern.ReplaceAllStringFunc(query, func(m string) string {
+		sub := clusterMatcherPattern.FindStringSubmatch(m)
+		value := sub[2][1 : len(sub[2])-1]
+		if sub[1] == "=~" || sub[1] == "!~" {
+			clusters := strings.Split(value, "|")
+			sort.Strings(clusters)
+			value = strings.Join(slices.Compact(clusters), "|")
+		}
+		scopes = append(scopes, sub[1]+value)
+		return fmt.Sprintf("taco_cluster%s$%d", sub[1], len(scopes)-1)
+	})
+	return collapseSpaces(query), strings.Join(scopes, ";")
+}
+
+// collapseSpaces collapses runs of whitespace outside of string literals into one space
+// and drops the spaces around punctuation.
+func collapseSpaces(query string) string {
+	const punctuation = "(){}[],=~!<>+-*/^%"
+	var b strings.Builder
+	var quote, last byte
+	space := false
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			b.WriteByte(ch)
+			last = ch
+			if ch == '\\' && i+1 < len(query) {
+				i++
+				b.WriteByte(query[i])
+			} else if ch == quote {
+				quote = 0
+			}
+			continue
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			space = true
+			continue
+		}
+
+		if space && last != 0 && !strings.ContainsRune(punctuation, rune(last)) &&
+			!strings.ContainsRune(punctuation, rune(ch)) {
+			b.WriteByte(' ')
+		}
+		space = false
+		if ch == '"' || ch == '\'' || ch == '`' {
+			quote = ch
+		}
+		b.WriteByte(ch)
+		last = ch
+	}
+	return b.String()
+}
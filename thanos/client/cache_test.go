@@ -0,0 +1,323 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newCountingServer answers every query with its query string and counts the requests
+func newCountingServer(t *testing.T, status int) (*httptest.Server, *atomic.Int64) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(r.URL.Query().Get("query")))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func newCachedClient(url string, opts CacheOptions, now *time.Time) *Client {
+	c := New(url)
+	c.Cache = NewCache(opts)
+	c.Cache.now = func() time.Time { return *now }
+	return c
+}
+
+func TestNormalizeQuery(t *testing.T) {
+	same := []string{
+		`sum by (kind) (opa_scorecard_constraint_violations{taco_cluster=~"c1|c2"})`,
+		`sum by(kind)(opa_scorecard_constraint_violations{taco_cluster=~'c2|c1'})`,
+		"sum  by (kind)\n\t(opa_scorecard_constraint_violations{ taco_cluster =~ \"c2|c1|c1\" })",
+	}
+	want, wantScope := normalizeQuery(same[0])
+	if wantScope != "=~c1|c2" {
+		t.Errorf("want scope (=~c1|c2) got (%s)", wantScope)
+	}
+	for _, q := range same[1:] {
+		if got, scope := normalizeQuery(q); got != want || scope != wantScope {
+			t.Errorf("want (%s, %s) got (%s, %s)", want, wantScope, got, scope)
+		}
+	}
+
+	for _, q := range []string{
+		`sum by (name) (opa_scorecard_constraint_violations{taco_cluster=~"c1|c2"})`,
+		`sum by (kind) (opa_scorecard_constraint_violations{taco_cluster=~"c1|c3"})`,
+		`sum by (kind) (opa_scorecard_constraint_violations{taco_cluster=~"c1|c2",kind="a  b"})`,
+		`sum by (kind) (opa_scorecard_constraint_violations{taco_cluster="c1|c2"})`,
+	} {
+		got, scope := normalizeQuery(q)
+		if got == want && scope == wantScope {
+			t.Errorf("%s must not share the key of %s", q, same[0])
+		}
+	}
+
+	// the value of an equality matcher is not a list of clusters
+	for _, op := range []string{"=", "!="} {
+		a, scopeA := normalizeQuery(`up{taco_cluster` + op + `"c2|c1|c1"}`)
+		b, scopeB := normalizeQuery(`up{taco_cluster` + op + `"c1|c2"}`)
+		if scopeA != op+"c2|c1|c1" || a == b && scopeA == scopeB {
+			t.Errorf("%s: unexpected scopes (%s, %s)", op, scopeA, scopeB)
+		}
+	}
+	if _, scope := normalizeQuery(`up{taco_cluster!~"c2|c1|c1"}`); scope != "!~c1|c2" {
+		t.Errorf("want scope (!~c1|c2) got (%s)", scope)
+	}
+
+	if got, _ := normalizeQuery(`up{job="a  b"} or  vector(0)`); got != `up{job="a  b"}or vector(0)` {
+		t.Errorf("unexpected normalized query (%s)", got)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	server, requests := newCountingServer(t, http.StatusOK)
+	now := time.Unix(1700000000, 0)
+	c := newCachedClient(server.URL, CacheOptions{
+		Bucket: time.Minute,
+		TTL:    map[QueryClass]time.Duration{QueryClassLive: 20 * time.Second},
+	}, &now)
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.Query(`up{taco_cluster=~"c1"}`); err != nil {
+			t.Fatalf("unexpected error - %s", err)
+		}
+	}
+	if requests.Load() != 1 {
+		t.Errorf("want 1 request got (%d)", requests.Load())
+	}
+
+	// same bucket but expired
+	now = now.Add(25 * time.Second)
+	if _, err := c.Query(`up{taco_cluster=~"c1"}`); err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("want 2 requests got (%d)", requests.Load())
+	}
+
+	// historical queries use their own TTL
+	ts := now.Add(-time.Hour)
+	for i := 0; i < 2; i++ {
+		if _, err := c.QueryAt(`up{taco_cluster=~"c1"}`, ts); err != nil {
+			t.Fatalf("unexpected error - %s", err)
+		}
+		now = now.Add(time.Minute)
+	}
+	if requests.Load() != 3 {
+		t.Errorf("want 3 requests got (%d)", requests.Load())
+	}
+
+	stats := c.Cache.Stats()
+	if stats.Hits != 3 || stats.Misses != 3 || stats.Entries != 2 {
+		t.Errorf("unexpected stats (%+v)", stats)
+	}
+}
+
+func TestCacheBucket(t *testing.T) {
+	server, requests := newCountingServer(t, http.StatusOK)
+	now := time.Unix(1700000000, 0)
+	c := newCachedClient(server.URL, CacheOptions{Bucket: 10 * time.Second}, &now)
+
+	for _, offset := range []time.Duration{0, 9 * time.Second, 10 * time.Second} {
+		now = time.Unix(1700000000, 0).Add(offset)
+		if _, err := c.Query("up"); err != nil {
+			t.Fatalf("unexpected error - %s", err)
+		}
+	}
+	if requests.Load() != 2 {
+		t.Errorf("want a request per bucket got (%d)", requests.Load())
+	}
+}
+
+func TestCacheSingleFlight(t *testing.T) {
+	release := make(chan struct{})
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		_, _ = w.Write([]byte(`{"status":"success"}`))
+	}))
+	defer server.Close()
+
+	c := New(server.URL)
+	c.Cache = NewCache(CacheOptions{})
+
+	const callers = 10
+	var wg sync.WaitGroup
+	bodies := make([]string, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body, err := c.Query("up")
+			if err != nil {
+				t.Errorf("unexpected error - %s", err)
+			}
+			bodies[i] = string(body)
+		}(i)
+	}
+
+	// wait until every caller is either in flight or waiting for it
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if stats := c.Cache.Stats(); stats.Misses+stats.Shared == callers {
+			break
+		}
+	}
+	close(release)
+	wg.Wait()
+
+	if requests.Load() != 1 {
+		t.Errorf("want 1 request got (%d)", requests.Load())
+	}
+	for _, body := range bodies {
+		if body != `{"status":"success"}` {
+			t.Errorf("unexpected body (%s)", body)
+		}
+	}
+	if stats := c.Cache.Stats(); stats.Shared != callers-1 {
+		t.Errorf("want %d shared got (%+v)", callers-1, stats)
+	}
+}
+
+func TestCacheSingleFlightCallerCanceled(t *testing.T) {
+	release := make(chan struct{})
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		_, _ = w.Write([]byte(`{"status":"success"}`))
+	}))
+	defer server.Close()
+
+	c := New(server.URL)
+	c.Cache = NewCache(CacheOptions{})
+
+	// the first caller starts the query and gives up while the second waits for it
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := c.QueryContext(ctx, "up", time.Time{})
+		first <- err
+	}()
+	for deadline := time.Now().Add(5 * time.Second); requests.Load() == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	second := make(chan string, 1)
+	go func() {
+		body, err := c.Query("up")
+		if err != nil {
+			t.Errorf("unexpected error - %s", err)
+		}
+		second <- string(body)
+	}()
+	for deadline := time.Now().Add(5 * time.Second); c.Cache.Stats().Shared == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-first:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("want context.Canceled got (%v)", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the canceled caller is still waiting")
+	}
+
+	close(release)
+	if body := <-second; body != `{"status":"success"}` {
+		t.Errorf("unexpected body (%s)", body)
+	}
+	if _, err := c.Query("up"); err != nil || requests.Load() != 1 {
+		t.Errorf("want the response cached got (%d requests, %v)", requests.Load(), err)
+	}
+}
+
+func TestCacheSingleFlightAllCallersCanceled(t *testing.T) {
+	canceled := make(chan struct{})
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			<-r.Context().Done()
+			close(canceled)
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"success"}`))
+	}))
+	defer server.Close()
+
+	c := New(server.URL)
+	c.Cache = NewCache(CacheOptions{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.QueryContext(ctx, "up", time.Time{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want context.DeadlineExceeded got (%v)", err)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the query of the last caller was not canceled")
+	}
+
+	// the canceled query is neither cached nor shared with the next caller
+	if body, err := c.Query("up"); err != nil || string(body) != `{"status":"success"}` {
+		t.Errorf("unexpected response (%s, %v)", body, err)
+	}
+}
+
+func TestCacheLRU(t *testing.T) {
+	server, requests := newCountingServer(t, http.StatusOK)
+	now := time.Unix(1700000000, 0)
+	c := newCachedClient(server.URL, CacheOptions{MaxEntries: 2}, &now)
+
+	for _, q := range []string{"a", "b", "a", "c", "a", "b"} {
+		if _, err := c.Query(q); err != nil {
+			t.Fatalf("unexpected error - %s", err)
+		}
+	}
+	// b is evicted by c, then c by b
+	if requests.Load() != 4 {
+		t.Errorf("want 4 requests got (%d)", requests.Load())
+	}
+	if stats := c.Cache.Stats(); stats.Evictions != 2 || stats.Entries != 2 {
+		t.Errorf("unexpected stats (%+v)", stats)
+	}
+}
+
+func TestCacheDoesNotCacheErrors(t *testing.T) {
+	server, requests := newCountingServer(t, http.StatusServiceUnavailable)
+	now := time.Unix(1700000000, 0)
+	c := newCachedClient(server.URL, CacheOptions{}, &now)
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Query("up"); err == nil {
+			t.Fatal("want error got nil")
+		}
+	}
+	if requests.Load() != 2 {
+		t.Errorf("want 2 requests got (%d)", requests.Load())
+	}
+}
+
+func TestCacheRangeQuery(t *testing.T) {
+	server, requests := newCountingServer(t, http.StatusOK)
+	now := time.Unix(1700000000, 0)
+	c := newCachedClient(server.URL, CacheOptions{}, &now)
+
+	start := now.Add(-time.Hour)
+	for _, step := range []time.Duration{time.Minute, time.Minute, 2 * time.Minute} {
+		if _, err := c.QueryRange("up", start, now, step); err != nil {
+			t.Fatalf("unexpected error - %s", err)
+		}
+	}
+	if requests.Load() != 2 {
+		t.Errorf("want a request per step got (%d)", requests.Load())
+	}
+}
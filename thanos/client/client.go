@@ -0,0 +1,152 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultURL = "http://siim.hopto.org:30001"
+
+// Client runs PromQL queries against the Thanos Query HTTP API.
+// Responses are cached when Cache is set, transient failures are retried as configured by Retry
+// and Breaker, when set, fails requests fast while Thanos is down.
+type Client struct {
+	URL        string
+	HTTPClient *http.Client
+	Cache      *Cache
+	Retry      RetryOptions
+	Breaker    *CircuitBreaker
+}
+
+func New(thanosUrl string) *Client {
+	return &Client{
+		URL: strings.TrimSuffix(thanosUrl, "/"),
+		HTTPClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{MaxIdleConns: 10},
+		},
+	}
+}
+
+// Query runs an instant query and returns the raw JSON response body
+func (c *Client) Query(query string) (out []byte, err error) {
+	return c.QueryContext(context.Background(), query, time.Time{})
+}
+
+// QueryAt runs an instant query evaluated at ts, a zero ts is evaluated at the current server time
+func (c *Client) QueryAt(query string, ts time.Time) (out []byte, err error) {
+	return c.QueryContext(context.Background(), query, ts)
+}
+
+// QueryContext is QueryAt which stops retrying and waiting for Thanos when ctx is done
+func (c *Client) QueryContext(ctx context.Context, query string, ts time.Time) (out []byte, err error) {
+	params := url.Values{"query": {query}}
+	if !ts.IsZero() {
+		params.Set("time", formatTime(ts))
+	}
+	if c.Cache == nil {
+		return c.get(ctx, "/api/v1/query", params)
+	}
+
+	key, class := c.Cache.instantKey(query, ts)
+	return c.Cache.do(ctx, key, class, func(ctx context.Context) ([]byte, error) {
+		return c.get(ctx, "/api/v1/query", params)
+	})
+}
+
+// QueryRange runs a range query from start to end with a resolution of step
+func (c *Client) QueryRange(query string, start time.Time, end time.Time, step time.Duration) (out []byte, err error) {
+	return c.QueryRangeContext(context.Background(), query, start, end, step)
+}
+
+// QueryRangeContext is QueryRange which stops retrying and waiting for Thanos when ctx is done
+func (c *Client) QueryRangeContext(ctx context.Context, query string, start time.Time, end time.Time, step time.Duration) (out []byte, err error) {
+	params := url.Values{
+		"query": {query},
+		"start": {formatTime(start)},
+		"end":   {formatTime(end)},
+		"step":  {strconv.FormatFloat(step.Seconds(), 'f', -1, 64)},
+	}
+	if c.Cache == nil {
+		return c.get(ctx, "/api/v1/query_range", params)
+	}
+
+	key, class := c.Cache.rangeKey(query, start, end, step)
+	return c.Cache.do(ctx, key, class, func(ctx context.Context) ([]byte, error) {
+		return c.get(ctx, "/api/v1/query_range", params)
+	})
+}
+
+// get calls Thanos and retries transient failures with an exponential backoff
+func (c *Client) get(ctx context.Context, path string, params url.Values) (out []byte, err error) {
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		out, err = c.getOnce(ctx, path, params)
+		if attempt > 1 && errors.Is(err, ErrCircuitOpen) {
+			// the previous attempt opened the circuit, its error tells more
+			return nil, lastErr
+		}
+		if err == nil || attempt >= c.Retry.MaxAttempts || !isTransient(ctx, err) {
+			return out, err
+		}
+		lastErr = err
+		if sleepErr := sleep(ctx, c.Retry.backoff(attempt)); sleepErr != nil {
+			return nil, fmt.Errorf("%w (last error: %s)", sleepErr, err)
+		}
+	}
+}
+
+// getOnce sends a single request through the circuit breaker
+func (c *Client) getOnce(ctx context.Context, path string, params url.Values) (out []byte, err error) {
+	if c.Breaker != nil {
+		if err := c.Breaker.allow(); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if ctx.Err() != nil {
+				c.Breaker.abandon()
+				return
+			}
+			c.Breaker.record(err != nil && isTransient(ctx, err))
+		}()
+	}
+
+	reqUrl := c.URL + path + "?" + params.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqUrl, nil)
+	if err != nil {
+		return out, err
+	}
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return out, err
+	}
+	if res == nil {
+		return out, fmt.Errorf("failed to call thanos")
+	}
+
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != 200 {
+		return out, newAPIError(res.StatusCode, body)
+	}
+
+	return body, nil
+}
+
+// formatTime formats ts as unix seconds with millisecond precision, as the Prometheus API expects
+func formatTime(ts time.Time) string {
+	return strconv.FormatFloat(float64(ts.UnixMilli())/1000, 'f', -1, 64)
+}
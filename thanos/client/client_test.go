@@ -0,0 +1,76 @@
+package client_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/seungkyua/go-test/thanos/client"
+)
+
+func TestClientQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			t.Errorf("want (/api/v1/query) got (%s)", r.URL.Path)
+		}
+		if q := r.URL.Query().Get("query"); q != `sum(up{taco_cluster=~"c1|c2"})` {
+			t.Errorf("unexpected query (%s)", q)
+		}
+		_, _ = w.Write([]byte(`{"status":"success"}`))
+	}))
+	defer server.Close()
+
+	out, err := client.New(server.URL + "/").Query(`sum(up{taco_cluster=~"c1|c2"})`)
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if string(out) != `{"status":"success"}` {
+		t.Errorf("unexpected body (%s)", out)
+	}
+}
+
+func TestClientQueryStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	want := "invalid http status. return code: 502"
+	if _, err := client.New(server.URL).Query("up"); err == nil || err.Error() != want {
+		t.Errorf("want (%s) got (%v)", want, err)
+	}
+}
+
+func TestClientQueryAt(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("time"); got != "1700000000.5" {
+			t.Errorf("want (1700000000.5) got (%s)", got)
+		}
+		_, _ = w.Write([]byte(`{"status":"success"}`))
+	}))
+	defer server.Close()
+
+	if _, err := client.New(server.URL).QueryAt("up", time.UnixMilli(1700000000500)); err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+}
+
+func TestClientQueryRange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query_range" {
+			t.Errorf("want (/api/v1/query_range) got (%s)", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Get("start") != "1700000000" || q.Get("end") != "1700003600" || q.Get("step") != "60" {
+			t.Errorf("unexpected range (%s)", r.URL.RawQuery)
+		}
+		_, _ = w.Write([]byte(`{"status":"success"}`))
+	}))
+	defer server.Close()
+
+	start := time.Unix(1700000000, 0)
+	if _, err := client.New(server.URL).QueryRange("up", start, start.Add(time.Hour), time.Minute); err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+}
@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RetryOptions retries requests which failed with a transient error: network timeouts, refused and reset connections,
+// 5xx and 429 responses and the Prometheus "unavailable" and "timeout" errors.
+type RetryOptions struct {
+	// MaxAttempts is the number of attempts including the first one, 0 or 1 disables retries
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry (default 200ms)
+	InitialBackoff time.Duration
+	// MaxBackoff bounds the wait between attempts (default 5s)
+	MaxBackoff time.Duration
+	// Multiplier grows the backoff after every retry (default 2)
+	Multiplier float64
+	// Jitter is the fraction of the backoff which is randomized, from 0 to 1 (default 0.2).
+	// A negative Jitter disables it.
+	Jitter float64
+}
+
+// backoff returns the wait before the given retry, starting at 1
+func (o RetryOptions) backoff(retry int) time.Duration {
+	initial, max, multiplier, jitter := o.InitialBackoff, o.MaxBackoff, o.Multiplier, o.Jitter
+	if initial <= 0 {
+		initial = 200 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 5 * time.Second
+	}
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	if jitter == 0 {
+		jitter = 0.2
+	}
+
+	d := math.Min(float64(initial)*math.Pow(multiplier, float64(retry-1)), float64(max))
+	if jitter > 0 {
+		d -= d * math.Min(jitter, 1) * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// APIError is a non-200 response of Thanos.
+// ErrorType and Message are read from the Prometheus error body when there is one.
+type APIError struct {
+	StatusCode int
+	ErrorType  string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.ErrorType == "" {
+		return fmt.Sprintf("invalid http status. return code: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("invalid http status. return code: %d (%s: %s)", e.StatusCode, e.ErrorType, e.Message)
+}
+
+// Temporary reports whether the request may succeed when retried: server errors and throttled requests
+func (e *APIError) Temporary() bool {
+	if e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return e.ErrorType == "unavailable" || e.ErrorType == "timeout"
+}
+
+func newAPIError(statusCode int, body []byte) *APIError {
+	e := &APIError{StatusCode: statusCode}
+	var res struct {
+		ErrorType string `json:"errorType"`
+		Error     string `json:"error"`
+	}
+	if json.Unmarshal(body, &res) == nil {
+		e.ErrorType, e.Message = res.ErrorType, res.Error
+	}
+	return e
+}
+
+// isTransient reports whether err of an attempt is worth a retry and counts as a failure of Thanos for the breaker.
+// Besides a temporary APIError, only network timeouts and refused, reset or closed connections are transient:
+// errors such as an invalid URL or a failed TLS verification fail the same way when retried.
+func isTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary()
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// ErrCircuitOpen is returned without calling Thanos while the circuit breaker is open
+var ErrCircuitOpen = errors.New("thanos circuit breaker is open")
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// CircuitBreaker fails requests fast once Thanos keeps failing.
+// It opens after FailureThreshold consecutive transient failures and rejects requests with ErrCircuitOpen.
+// After OpenTimeout it lets one probe request through, the circuit closes when the probe succeeds
+// and opens again when it fails.
+type CircuitBreaker struct {
+	failureThreshold int
+	openTimeout      time.Duration
+	now              func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+// NewCircuitBreaker returns a closed circuit breaker, the defaults are 5 failures and 30s
+func NewCircuitBreaker(failureThreshold int, openTimeout time.Duration) *CircuitBreaker {
+	if failureThreshold <= 0 {
+		failureThreshold = 5
+	}
+	if openTimeout <= 0 {
+		openTimeout = 30 * time.Second
+	}
+	return &CircuitBreaker{
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		now:              time.Now,
+		state:            CircuitClosed,
+	}
+}
+
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// allow returns ErrCircuitOpen when a request must not be sent
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if b.now().Sub(b.openedAt) < b.openTimeout {
+			return ErrCircuitOpen
+		}
+		b.state = CircuitHalfOpen
+		return nil
+	case CircuitHalfOpen:
+		// a probe is in flight
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// record counts the result of a request which was allowed
+func (b *CircuitBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		b.state = CircuitClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.failureThreshold {
+		b.state = CircuitOpen
+		b.openedAt = b.now()
+	}
+}
+
+// abandon releases a request which was allowed but ended without a result, such as a canceled probe.
+// An abandoned probe leaves the circuit open with its timeout elapsed, so that the next request probes again.
+func (b *CircuitBreaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitHalfOpen {
+		b.state = CircuitOpen
+	}
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
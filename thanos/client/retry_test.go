@@ -0,0 +1,196 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/seungkyua/go-test/thanos/client"
+)
+
+// newFlakyServer fails the first failures requests with status and body, then succeeds
+func newFlakyServer(t *testing.T, failures int64, status int, body string) (*httptest.Server, *atomic.Int64) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(body))
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"success"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func newRetryingClient(url string, attempts int) *client.Client {
+	c := client.New(url)
+	c.Retry = client.RetryOptions{MaxAttempts: attempts, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+	return c
+}
+
+func TestClientRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		attempts int
+		wantErr  bool
+		requests int64
+	}{
+		{"bad gateway", http.StatusBadGateway, "", 3, false, 3},
+		{"gateway timeout", http.StatusGatewayTimeout, "", 3, false, 3},
+		{"prometheus timeout", http.StatusServiceUnavailable, `{"status":"error","errorType":"timeout","error":"query timed out"}`, 3, false, 3},
+		{"prometheus unavailable", 599, `{"status":"error","errorType":"unavailable","error":"no store"}`, 3, false, 3},
+		{"attempts exhausted", http.StatusServiceUnavailable, "", 2, true, 2},
+		{"bad data", http.StatusBadRequest, `{"status":"error","errorType":"bad_data","error":"parse error"}`, 3, true, 1},
+		{"internal error", http.StatusInternalServerError, "", 3, false, 3},
+		{"too many requests", http.StatusTooManyRequests, "", 3, false, 3},
+		{"unprocessable", http.StatusUnprocessableEntity, `{"status":"error","errorType":"execution","error":"many-to-many matching"}`, 3, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := newFlakyServer(t, 2, tt.status, tt.body)
+			_, err := newRetryingClient(server.URL, tt.attempts).Query("up")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("want error (%t) got (%v)", tt.wantErr, err)
+			}
+			if requests.Load() != tt.requests {
+				t.Errorf("want %d requests got (%d)", tt.requests, requests.Load())
+			}
+		})
+	}
+}
+
+func TestClientRetryAPIError(t *testing.T) {
+	server, _ := newFlakyServer(t, 1, http.StatusBadRequest, `{"status":"error","errorType":"bad_data","error":"parse error"}`)
+	_, err := newRetryingClient(server.URL, 3).Query("up{")
+
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.ErrorType != "bad_data" {
+		t.Fatalf("want APIError got (%v)", err)
+	}
+	if !strings.Contains(err.Error(), "parse error") {
+		t.Errorf("want the prometheus message in (%s)", err)
+	}
+}
+
+func TestClientRetryConnectionError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	c := newRetryingClient(server.URL, 3)
+	c.Breaker = client.NewCircuitBreaker(1, time.Hour)
+	_, err := c.Query("up")
+	var apiErr *client.APIError
+	if err == nil || errors.As(err, &apiErr) {
+		t.Errorf("want connection error got (%v)", err)
+	}
+	// a refused connection is a failure of Thanos
+	if c.Breaker.State() != client.CircuitOpen {
+		t.Errorf("want the breaker open got (%s)", c.Breaker.State())
+	}
+}
+
+func TestClientRetryPermanentTransportError(t *testing.T) {
+	// a client which does not trust the certificate of the server
+	var connections atomic.Int64
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	for _, url := range []string{server.URL, "http://%zz"} {
+		c := newRetryingClient(url, 3)
+		c.Breaker = client.NewCircuitBreaker(1, time.Hour)
+		if _, err := c.Query("up"); err == nil {
+			t.Fatalf("%s: want error got nil", url)
+		}
+		if c.Breaker.State() != client.CircuitClosed {
+			t.Errorf("%s: want the breaker closed got (%s)", url, c.Breaker.State())
+		}
+	}
+	if connections.Load() != 1 {
+		t.Errorf("want 1 connection got (%d)", connections.Load())
+	}
+}
+
+func TestClientRetryContextCanceled(t *testing.T) {
+	server, requests := newFlakyServer(t, 100, http.StatusServiceUnavailable, "")
+	c := client.New(server.URL)
+	c.Retry = client.RetryOptions{MaxAttempts: 10, InitialBackoff: time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.QueryContext(ctx, "up", time.Time{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want deadline exceeded got (%v)", err)
+	}
+	if time.Since(start) > 5*time.Second || requests.Load() != 1 {
+		t.Errorf("want the backoff to stop on cancel got %d requests in %s", requests.Load(), time.Since(start))
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"success"}`))
+	}))
+	defer server.Close()
+
+	c := newRetryingClient(server.URL, 2)
+	c.Breaker = client.NewCircuitBreaker(4, 50*time.Millisecond)
+
+	// two calls of two attempts open the circuit
+	for i := 0; i < 2; i++ {
+		if _, err := c.Query("up"); err == nil || errors.Is(err, client.ErrCircuitOpen) {
+			t.Fatalf("want a thanos error got (%v)", err)
+		}
+	}
+	if c.Breaker.State() != client.CircuitOpen {
+		t.Fatalf("want open got (%s)", c.Breaker.State())
+	}
+	if _, err := c.Query("up"); !errors.Is(err, client.ErrCircuitOpen) || requests.Load() != 4 {
+		t.Errorf("want fail fast got (%v) after %d requests", err, requests.Load())
+	}
+
+	// a failed probe opens the circuit again
+	time.Sleep(60 * time.Millisecond)
+	if _, err := c.Query("up"); err == nil || errors.Is(err, client.ErrCircuitOpen) || requests.Load() != 5 {
+		t.Errorf("want a single failed probe got (%v) after %d requests", err, requests.Load())
+	}
+	if c.Breaker.State() != client.CircuitOpen {
+		t.Fatalf("want open got (%s)", c.Breaker.State())
+	}
+
+	// a successful probe closes it
+	failing.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	if _, err := c.Query("up"); err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if c.Breaker.State() != client.CircuitClosed {
+		t.Errorf("want closed got (%s)", c.Breaker.State())
+	}
+}
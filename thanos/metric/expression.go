@@ -0,0 +1,165 @@
+package metric
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/seungkyua/go-test/interface/embed"
+	"github.com/seungkyua/go-test/thanos/client"
+)
+
+// ExpressionResolver is an embed.MathResolver of formulas over metrics, such as a KPI
+// deny_violations / total_policies * 100, where every variable is the value of a named instant query.
+// A query must return a scalar or a single series, write "sum(...) or vector(0)" for a series which may be missing.
+type ExpressionResolver struct {
+	Client *client.Client
+	// Queries are the PromQL instant queries of the variables by name
+	Queries map[string]string
+	// Time is the evaluation time of the queries, zero is the current server time
+	Time time.Time
+	// Functions are callable from the formulas besides the built-in functions of embed
+	Functions map[string]embed.Function
+}
+
+// InstantMetric is the response of an instant query of a scalar or a single series
+type InstantMetric struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+func (r ExpressionResolver) Resolve(expression string) (float64, error) {
+	return r.resolve(context.Background(), nil, expression)
+}
+
+// ResolveSession resolves an expression with the variables of s, which hide the queries of the same name,
+// and binds assignments in s, so that a Calculator can derive KPIs from one another.
+// Each query is run once per expression, only when the expression uses it.
+func (r ExpressionResolver) ResolveSession(s *embed.Session, expression string) (float64, error) {
+	return r.resolve(context.Background(), s, expression)
+}
+
+// ResolveContext is ResolveSession with the session of ctx, the queries stop when ctx is done
+func (r ExpressionResolver) ResolveContext(ctx context.Context, expression string) (float64, error) {
+	return r.resolve(ctx, embed.SessionFromContext(ctx), expression)
+}
+
+func (r ExpressionResolver) resolve(ctx context.Context, s *embed.Session, expression string) (float64, error) {
+	n, err := embed.Parse(expression)
+	if err != nil {
+		return 0, err
+	}
+	values, err := r.queryVariables(ctx, n, s)
+	if err != nil {
+		return 0, err
+	}
+
+	evaluator := embed.ArithmeticResolver{Functions: r.Functions}
+	if s == nil {
+		return evaluator.Eval(n, values)
+	}
+	return evaluator.Eval(n, sessionValues{Session: s, values: values})
+}
+
+// queryVariables runs the queries of the variables of n which s does not define
+func (r ExpressionResolver) queryVariables(ctx context.Context, n embed.Node, s *embed.Session) (metricValues, error) {
+	names := make(map[string]bool)
+	variables(n, names)
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		if _, ok := r.Queries[name]; !ok {
+			continue
+		}
+		if s != nil {
+			if _, ok := s.Get(name); ok {
+				continue
+			}
+		}
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	values := make(metricValues, len(sorted))
+	for _, name := range sorted {
+		v, err := r.query(ctx, r.Queries[name])
+		if err != nil {
+			return nil, fmt.Errorf("metric %s: %w", name, err)
+		}
+		values[name] = v
+	}
+	return values, nil
+}
+
+func (r ExpressionResolver) query(ctx context.Context, query string) (float64, error) {
+	var im InstantMetric
+	if err := getThanosMetricContext(ctx, r.Client, query, r.Time, &im); err != nil {
+		return 0, err
+	}
+
+	switch im.Data.ResultType {
+	case "scalar":
+		var sample []interface{}
+		if err := json.Unmarshal(im.Data.Result, &sample); err != nil {
+			return 0, fmt.Errorf("unmarshal %s: %w", query, err)
+		}
+		return sampleValue(sample)
+	case "vector":
+		var series []struct {
+			Value []interface{} `json:"value"`
+		}
+		if err := json.Unmarshal(im.Data.Result, &series); err != nil {
+			return 0, fmt.Errorf("unmarshal %s: %w", query, err)
+		}
+		if len(series) != 1 {
+			return 0, fmt.Errorf("query %s returned %d series, expected 1", query, len(series))
+		}
+		return sampleValue(series[0].Value)
+	}
+	return 0, fmt.Errorf("query %s returned a %q result, expected a scalar or a vector", query, im.Data.ResultType)
+}
+
+// variables adds the names of the variables of n to names
+func variables(n embed.Node, names map[string]bool) {
+	switch n := n.(type) {
+	case *embed.VariableNode:
+		names[n.Name()] = true
+	case *embed.AssignNode:
+		variables(n.Value(), names)
+	case *embed.CallNode:
+		for _, arg := range n.Args() {
+			variables(arg, names)
+		}
+	case *embed.UnaryNode:
+		variables(n.Operand(), names)
+	case *embed.BinaryNode:
+		variables(n.Left(), names)
+		variables(n.Right(), names)
+	}
+}
+
+// metricValues are the values of the queries of an expression, it does not bind assignments
+type metricValues map[string]float64
+
+func (m metricValues) Get(name string) (float64, bool) {
+	v, ok := m[name]
+	return v, ok
+}
+
+// sessionValues are the variables of a session and the values of the queries the session does not hide
+type sessionValues struct {
+	*embed.Session
+	values metricValues
+}
+
+func (s sessionValues) Get(name string) (float64, bool) {
+	if v, ok := s.Session.Get(name); ok {
+		return v, ok
+	}
+	return s.values.Get(name)
+}
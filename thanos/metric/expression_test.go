@@ -0,0 +1,226 @@
+package metric_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/seungkyua/go-test/interface/embed"
+	"github.com/seungkyua/go-test/thanos/client"
+	"github.com/seungkyua/go-test/thanos/metric"
+)
+
+// thanosStub answers instant queries with the result of each query and counts them
+type thanosStub struct {
+	t       *testing.T
+	results map[string]string
+
+	mu      sync.Mutex
+	queries map[string]int
+}
+
+func newThanosStub(t *testing.T, results map[string]string) (*thanosStub, *client.Client) {
+	stub := &thanosStub{t: t, results: results, queries: make(map[string]int)}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	return stub, client.New(server.URL)
+}
+
+func (s *thanosStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/v1/query" {
+		s.t.Errorf("want (/api/v1/query) got (%s)", r.URL.Path)
+	}
+	query := r.URL.Query().Get("query")
+	s.mu.Lock()
+	s.queries[query]++
+	s.mu.Unlock()
+
+	result, ok := s.results[query]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+		return
+	}
+	_, _ = w.Write([]byte(`{"status":"success","data":` + result + `}`))
+}
+
+func (s *thanosStub) count(query string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries[query]
+}
+
+const (
+	denyQuery   = `sum(opa_scorecard_constraint_violations{violation_enforcement=""})`
+	totalQuery  = `count(opa_scorecard_constraint_violations)`
+	limitQuery  = `scalar(policy_limit)`
+	splitQuery  = `opa_scorecard_constraint_violations`
+	emptyQuery  = `sum(missing)`
+	matrixQuery = `up[5m]`
+	nanQuery    = `sum(a) / sum(b)`
+	infQuery    = `scalar(1 / 0)`
+)
+
+var stubResults = map[string]string{
+	denyQuery:   `{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"12"]}]}`,
+	totalQuery:  `{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"48"]}]}`,
+	limitQuery:  `{"resultType":"scalar","result":[1700000000,"20"]}`,
+	splitQuery:  `{"resultType":"vector","result":[{"metric":{"kind":"a"},"value":[1700000000,"1"]},{"metric":{"kind":"b"},"value":[1700000000,"2"]}]}`,
+	emptyQuery:  `{"resultType":"vector","result":[]}`,
+	matrixQuery: `{"resultType":"matrix","result":[]}`,
+	nanQuery:    `{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"NaN"]}]}`,
+	infQuery:    `{"resultType":"scalar","result":[1700000000,"+Inf"]}`,
+}
+
+var stubQueries = map[string]string{
+	"deny_violations": denyQuery,
+	"total_policies":  totalQuery,
+	"limit":           limitQuery,
+	"by_kind":         splitQuery,
+	"missing":         emptyQuery,
+	"samples":         matrixQuery,
+	"invalid":         `sum(`,
+	"ratio":           nanQuery,
+	"unbounded":       infQuery,
+}
+
+func TestExpressionResolver(t *testing.T) {
+	stub, thanosClient := newThanosStub(t, stubResults)
+	r := metric.ExpressionResolver{Client: thanosClient, Queries: stubQueries}
+
+	for _, test := range []struct {
+		expression string
+		want       float64
+		err        string
+	}{
+		{"deny_violations / total_policies * 100", 25, ""},
+		{"round(deny_violations / limit * 100, 1)", 60, ""},
+		{"max(deny_violations, deny_violations * 2)", 24, ""},
+		{"limit - unknown", 0, `undefined variable "unknown" at column 9`},
+		{"by_kind + 1", 0, "metric by_kind: query " + splitQuery + " returned 2 series, expected 1"},
+		{"missing", 0, "metric missing: query " + emptyQuery + ` returned 0 series, expected 1`},
+		{"samples", 0, "metric samples: query " + matrixQuery + ` returned a "matrix" result, expected a scalar or a vector`},
+		{"invalid", 0, "metric invalid: query sum(: invalid http status. return code: 400 (bad_data: parse error)"},
+		{"percentile(ratio, 1, 2)", 0, `metric ratio: invalid sample value "NaN"`},
+		{"unbounded * 0", 0, `metric unbounded: invalid sample value "+Inf"`},
+		{"kpi = limit", 0, `assignment to "kpi" needs a session at column 1`},
+		{"limit +", 0, "unexpected end of expression at column 8"},
+	} {
+		got, err := r.Resolve(test.expression)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Resolve(%q): expected error %q, got %v", test.expression, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Resolve(%q): unexpected error - %s", test.expression, err)
+		} else if got != test.want {
+			t.Errorf("Resolve(%q): expected %g, got %g", test.expression, test.want, got)
+		}
+	}
+
+	// a query is run once per expression
+	if got := stub.count(denyQuery); got != 3 {
+		t.Errorf("expected 3 queries of deny_violations, got %d", got)
+	}
+}
+
+func TestExpressionResolverTime(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("time"); got != "1700000000" {
+			t.Errorf("want (1700000000) got (%s)", got)
+		}
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"scalar","result":[1700000000,"3"]}}`))
+	}))
+	defer server.Close()
+
+	r := metric.ExpressionResolver{
+		Client:    client.New(server.URL),
+		Queries:   map[string]string{"cores": "scalar(sum(cpu))"},
+		Time:      time.Unix(1700000000, 0),
+		Functions: map[string]embed.Function{"millicores": embed.Func1(func(x float64) float64 { return x * 1000 })},
+	}
+	if got, err := r.Resolve("millicores(cores)"); err != nil || got != 3000 {
+		t.Errorf("unexpected result %g, %v", got, err)
+	}
+}
+
+func TestExpressionResolverTimeout(t *testing.T) {
+	canceled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(canceled)
+	}))
+	defer server.Close()
+
+	c := embed.Calculator{
+		Resolver:   metric.ExpressionResolver{Client: client.New(server.URL), Queries: map[string]string{"slow": "sum(slow)"}},
+		Middleware: []embed.Middleware{embed.Timeout(50 * time.Millisecond)},
+	}
+	if _, err := c.Process(strings.NewReader("slow + 1")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want context.DeadlineExceeded got (%v)", err)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the query was not canceled")
+	}
+}
+
+func TestExpressionResolverCalculator(t *testing.T) {
+	stub, thanosClient := newThanosStub(t, stubResults)
+	c := embed.Calculator{
+		Resolver: metric.ExpressionResolver{Client: thanosClient, Queries: stubQueries},
+		Session:  embed.NewSession(),
+	}
+
+	results, err := c.ProcessAll(strings.NewReader(`# KPIs of the policy dashboard
+deny_ratio = deny_violations / total_policies * 100
+_ / 5
+limit = 40
+deny_violations / limit * 100
+missing
+`))
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+
+	want := []struct {
+		value float64
+		err   string
+	}{
+		{25, ""},
+		{5, ""},
+		{40, ""},
+		{30, ""},
+		{0, "metric missing: query " + emptyQuery + " returned 0 series, expected 1"},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d results, got %d", len(want), len(results))
+	}
+	for i, w := range want {
+		got := results[i]
+		if w.err != "" {
+			if got.Err == nil || got.Err.Error() != w.err {
+				t.Errorf("line %d: expected error %q, got %v", got.Line, w.err, got.Err)
+			}
+			continue
+		}
+		if got.Err != nil {
+			t.Errorf("line %d: unexpected error - %s", got.Line, got.Err)
+		} else if got.Value != w.value {
+			t.Errorf("line %d: expected %g, got %g", got.Line, w.value, got.Value)
+		}
+	}
+
+	// the limit of the session hides the limit query
+	if got := stub.count(limitQuery); got != 0 {
+		t.Errorf("expected no query of limit, got %d", got)
+	}
+}
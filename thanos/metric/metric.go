@@ -0,0 +1,226 @@
+// Package metric queries the OPA Gatekeeper policy metrics of TKS clusters from Thanos
+// and shapes them for the dashboard charts.
+package metric
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/seungkyua/go-test/thanos/client"
+)
+
+type PolicyMetric struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric struct {
+				Kind      string `json:"kind"`
+				Name      string `json:"name"`
+				Violation string `json:"violation_enforcement"`
+			} `json:"metric"`
+			Value []interface{} `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+type PolicyTemplateMetric struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric struct {
+				Kind string `json:"kind"`
+			} `json:"metric"`
+			Value []interface{} `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+type PolicyViolationCountMetric struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric struct {
+				ViolationEnforcement string `json:"violation_enforcement,omitempty"`
+			} `json:"metric"`
+			Value []interface{} `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// BarChartData Policy metric struct
+type BarChartData struct {
+	XAxis  *Axis        `json:"xAxis,omitempty"`
+	Series []UnitNumber `json:"series,omitempty"`
+}
+
+type Axis struct {
+	Data []string `json:"data"`
+}
+
+type UnitNumber struct {
+	Name string `json:"name"`
+	Data []int  `json:"data"`
+}
+
+type PolicyViolationMetric struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric struct {
+				Kind                 string `json:"kind"`
+				Name                 string `json:"name"`
+				Cluster              string `json:"taco_cluster"`
+				ViolatingKind        string `json:"violating_kind"`
+				ViolatingNamespace   string `json:"violating_namespace"`
+				ViolatingName        string `json:"violating_name"`
+				ViolatingMsg         string `json:"violation_msg"`
+				ViolationEnforcement string `json:"violation_enforcement"`
+			} `json:"metric"`
+			Value []interface{} `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+type WorkloadMetric struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric struct {
+			} `json:"metric"`
+			Value []interface{} `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+type GetPolicyViolationResponse struct {
+	PolicyTemplateName string
+	PolicyName         string
+	StackId            string
+	ViolatingKind      string
+	ViolatingName      string
+}
+
+// getThanosMetricContext runs an instant query evaluated at ts (zero is now) and unmarshals the response into out,
+// it stops waiting for Thanos when ctx is done
+func getThanosMetricContext(ctx context.Context, thanosClient *client.Client, query string, ts time.Time, out interface{}) error {
+	body, err := thanosClient.QueryContext(ctx, query, ts)
+	if err != nil {
+		return fmt.Errorf("query %s: %w", query, err)
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("unmarshal %s: %w", query, err)
+	}
+	return nil
+}
+
+// sampleValue returns the value of a [timestamp, "value"] sample
+func sampleValue(sample []interface{}) (float64, error) {
+	if len(sample) != 2 {
+		return 0, fmt.Errorf("invalid sample %v", sample)
+	}
+	s, ok := sample[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("invalid sample value %v", sample[1])
+	}
+	// NaN and ±Inf samples, such as the ratio 0/0, are not values
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("invalid sample value %q", s)
+	}
+	return v, nil
+}
+
+// sampleCount returns the value of a [timestamp, "value"] sample of a count
+func sampleCount(sample []interface{}) (int, error) {
+	v, err := sampleValue(sample)
+	if err != nil {
+		return 0, err
+	}
+	return int(v), nil
+}
+
+func getBarChartData(pm PolicyMetric) (*BarChartData, error) {
+	// totalViolation: {"K8sRequiredLabels": {"violation_enforcement": 2}}
+	totalViolation := make(map[string]map[string]int)
+
+	// X축
+	xData := make([]string, 0)
+
+	for _, res := range pm.Data.Result {
+		policyTemplate := res.Metric.Kind
+		if !slices.Contains(xData, policyTemplate) {
+			xData = append(xData, policyTemplate)
+		}
+
+		count, err := sampleCount(res.Value)
+		if err != nil {
+			return nil, fmt.Errorf("policy template %s: %w", policyTemplate, err)
+		}
+		violation := enforcementAction(res.Metric.Violation)
+		if totalViolation[policyTemplate] == nil {
+			totalViolation[policyTemplate] = make(map[string]int)
+		}
+		totalViolation[policyTemplate][violation] += count
+	}
+
+	return newBarChartData(xData, totalViolation), nil
+}
+
+// newBarChartData builds the deny, warn and dryrun series of the policy templates in xData
+// from their violation counts by enforcement action.
+func newBarChartData(xData []string, totalViolation map[string]map[string]int) *BarChartData {
+	// Y축
+	var series []UnitNumber
+	yDenyData := make([]int, 0, len(xData))
+	yWarnData := make([]int, 0, len(xData))
+	yDryrunData := make([]int, 0, len(xData))
+
+	// series follow the order of the x axis
+	for _, policyTemplate := range xData {
+		violations := totalViolation[policyTemplate]
+		yDenyData = append(yDenyData, violations["deny"])
+		yWarnData = append(yWarnData, violations["warn"])
+		yDryrunData = append(yDryrunData, violations["dryrun"])
+	}
+
+	// X축
+	xAxis := &Axis{
+		Data: xData,
+	}
+
+	denyUnit := UnitNumber{
+		Name: "거부",
+		Data: yDenyData,
+	}
+	series = append(series, denyUnit)
+
+	warnUnit := UnitNumber{
+		Name: "경고",
+		Data: yWarnData,
+	}
+	series = append(series, warnUnit)
+
+	dryrunUnit := UnitNumber{
+		Name: "감사",
+		Data: yDryrunData,
+	}
+	series = append(series, dryrunUnit)
+
+	bcd := &BarChartData{
+		XAxis:  xAxis,
+		Series: series,
+	}
+
+	return bcd
+}
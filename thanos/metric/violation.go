@@ -0,0 +1,191 @@
+package metric
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/seungkyua/go-test/thanos/client"
+)
+
+const violationMetric = "opa_scorecard_constraint_violations"
+
+// QueryOptions selects the clusters and the time of the policy metrics.
+// A zero Time is evaluated at the current server time. With a Range the metrics are the peak (max_over_time)
+// of the Range ending at Time instead of the last sample.
+type QueryOptions struct {
+	Clusters []string
+	Time     time.Time
+	Range    time.Duration
+}
+
+// PolicyViolationLog is a resource violating a policy on a cluster
+type PolicyViolationLog struct {
+	Cluster            string `json:"cluster"`
+	PolicyTemplate     string `json:"policyTemplate"`
+	Policy             string `json:"policy"`
+	EnforcementAction  string `json:"enforcementAction"`
+	ViolatingKind      string `json:"violatingKind"`
+	ViolatingNamespace string `json:"violatingNamespace,omitempty"`
+	ViolatingName      string `json:"violatingName"`
+	Message            string `json:"message"`
+}
+
+// selector returns the series of metric on the clusters of opts with the extra label matchers,
+// wrapped in max_over_time when opts has a Range.
+func (opts QueryOptions) selector(metric string, matchers ...string) string {
+	quoted := make([]string, 0, len(opts.Clusters))
+	for _, cluster := range opts.Clusters {
+		quoted = append(quoted, regexp.QuoteMeta(cluster))
+	}
+	matchers = append([]string{fmt.Sprintf("taco_cluster=~%q", strings.Join(quoted, "|"))}, matchers...)
+
+	sel := fmt.Sprintf("%s{%s}", metric, strings.Join(matchers, ","))
+	if opts.Range > 0 {
+		sel = fmt.Sprintf("max_over_time(%s[%s])", sel, model.Duration(opts.Range))
+	}
+	return sel
+}
+
+// ParseTime parses an evaluation time given as RFC3339 or unix seconds with an optional fraction
+func ParseTime(s string) (time.Time, error) {
+	if ts, err := time.Parse(time.RFC3339, s); err == nil {
+		return ts, nil
+	}
+	sec, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", s)
+	}
+	return time.UnixMilli(int64(math.Round(sec * 1000))), nil
+}
+
+// enforcementAction returns the enforcement action of a violation, constraints without one are denied
+func enforcementAction(violation string) string {
+	if violation == "" {
+		return "deny"
+	}
+	return violation
+}
+
+// GetPolicyViolationChart returns the violations of every policy template by enforcement action
+func GetPolicyViolationChart(ctx context.Context, thanosClient *client.Client, opts QueryOptions) (*BarChartData, error) {
+	query := fmt.Sprintf("sum by (kind,name,violation_enforcement) (%s)", opts.selector(violationMetric))
+
+	var pm PolicyMetric
+	if err := getThanosMetricContext(ctx, thanosClient, query, opts.Time, &pm); err != nil {
+		return nil, err
+	}
+	return getBarChartData(pm)
+}
+
+// GetPolicyViolationTopChart returns the n policy templates with the most violations by enforcement action
+func GetPolicyViolationTopChart(ctx context.Context, thanosClient *client.Client, opts QueryOptions, n int) (*BarChartData, error) {
+	query := fmt.Sprintf("topk (%d, sum by (kind) (%s))", n, opts.selector(violationMetric))
+
+	var ptm PolicyTemplateMetric
+	if err := getThanosMetricContext(ctx, thanosClient, query, opts.Time, &ptm); err != nil {
+		return nil, err
+	}
+
+	// topk doesn't sort the result
+	templateNames := make([]string, 0, len(ptm.Data.Result))
+	totals := make(map[string]float64)
+	for _, result := range ptm.Data.Result {
+		templateNames = append(templateNames, result.Metric.Kind)
+		total, err := sampleValue(result.Value)
+		if err != nil {
+			return nil, fmt.Errorf("policy template %s: %w", result.Metric.Kind, err)
+		}
+		totals[result.Metric.Kind] = total
+	}
+	sort.SliceStable(templateNames, func(i, j int) bool {
+		return totals[templateNames[i]] > totals[templateNames[j]]
+	})
+
+	totalViolation := make(map[string]map[string]int)
+	for _, templateName := range templateNames {
+		query = fmt.Sprintf("sum by (violation_enforcement) (%s)",
+			opts.selector(violationMetric, fmt.Sprintf("kind=%q", templateName)))
+
+		var pvcm PolicyViolationCountMetric
+		if err := getThanosMetricContext(ctx, thanosClient, query, opts.Time, &pvcm); err != nil {
+			return nil, err
+		}
+
+		totalViolation[templateName] = make(map[string]int)
+		for _, result := range pvcm.Data.Result {
+			count, err := sampleCount(result.Value)
+			if err != nil {
+				return nil, fmt.Errorf("policy template %s: %w", templateName, err)
+			}
+			totalViolation[templateName][enforcementAction(result.Metric.ViolationEnforcement)] += count
+		}
+	}
+	return newBarChartData(templateNames, totalViolation), nil
+}
+
+// GetPolicyViolationLog returns the violating resources of the clusters
+func GetPolicyViolationLog(ctx context.Context, thanosClient *client.Client, opts QueryOptions) ([]PolicyViolationLog, error) {
+	query := fmt.Sprintf("group(%s) "+
+		"by (violating_kind, violating_namespace, violating_name, name, kind, violation_enforcement, violation_msg, taco_cluster)",
+		opts.selector(violationMetric))
+
+	var pvm PolicyViolationMetric
+	if err := getThanosMetricContext(ctx, thanosClient, query, opts.Time, &pvm); err != nil {
+		return nil, err
+	}
+
+	logs := make([]PolicyViolationLog, 0, len(pvm.Data.Result))
+	for _, result := range pvm.Data.Result {
+		m := result.Metric
+		logs = append(logs, PolicyViolationLog{
+			Cluster:            m.Cluster,
+			PolicyTemplate:     m.Kind,
+			Policy:             m.Name,
+			EnforcementAction:  enforcementAction(m.ViolationEnforcement),
+			ViolatingKind:      m.ViolatingKind,
+			ViolatingNamespace: m.ViolatingNamespace,
+			ViolatingName:      m.ViolatingName,
+			Message:            m.ViolatingMsg,
+		})
+	}
+	sort.Slice(logs, func(i, j int) bool {
+		a, b := logs[i], logs[j]
+		for _, cmp := range [][2]string{
+			{a.Cluster, b.Cluster}, {a.PolicyTemplate, b.PolicyTemplate}, {a.Policy, b.Policy},
+			{a.ViolatingNamespace, b.ViolatingNamespace}, {a.ViolatingKind, b.ViolatingKind}, {a.ViolatingName, b.ViolatingName},
+		} {
+			if cmp[0] != cmp[1] {
+				return cmp[0] < cmp[1]
+			}
+		}
+		return a.Message < b.Message
+	})
+	return logs, nil
+}
+
+// GetWorkloadCount returns the number of deployments with available replicas on the clusters
+func GetWorkloadCount(ctx context.Context, thanosClient *client.Client, opts QueryOptions) (int, error) {
+	query := fmt.Sprintf("count (%s != 0)", opts.selector("kube_deployment_status_replicas_available"))
+
+	var wm WorkloadMetric
+	if err := getThanosMetricContext(ctx, thanosClient, query, opts.Time, &wm); err != nil {
+		return 0, err
+	}
+	// count of an empty vector is an empty vector
+	if len(wm.Data.Result) == 0 {
+		return 0, nil
+	}
+	count, err := sampleCount(wm.Data.Result[0].Value)
+	if err != nil {
+		return 0, fmt.Errorf("workload count: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,52 @@
+package metric_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/seungkyua/go-test/thanos/client"
+	"github.com/seungkyua/go-test/thanos/metric"
+)
+
+func TestPolicyViolationMalformedSample(t *testing.T) {
+	for _, value := range []string{`[1700000000]`, `[1700000000,3]`, `[1700000000,"three"]`, `null`} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"kind":"K8sRequiredLabels","name":"p1"},"value":` + value + `}
+			]}}`))
+		}))
+		thanosClient := client.New(server.URL)
+		opts := metric.QueryOptions{Clusters: []string{"c1"}}
+
+		if _, err := metric.GetPolicyViolationChart(context.Background(), thanosClient, opts); err == nil {
+			t.Errorf("GetPolicyViolationChart(%s): expected an error", value)
+		}
+		if _, err := metric.GetPolicyViolationTopChart(context.Background(), thanosClient, opts, 5); err == nil {
+			t.Errorf("GetPolicyViolationTopChart(%s): expected an error", value)
+		}
+		if _, err := metric.GetWorkloadCount(context.Background(), thanosClient, opts); err == nil {
+			t.Errorf("GetWorkloadCount(%s): expected an error", value)
+		}
+		server.Close()
+	}
+}
+
+func TestPolicyViolationChart(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"kind":"K8sRequiredLabels","name":"p1"},"value":[1700000000,"3"]},
+			{"metric":{"kind":"K8sRequiredLabels","name":"p2","violation_enforcement":"warn"},"value":[1700000000,"2"]}
+		]}}`))
+	}))
+	defer server.Close()
+
+	chart, err := metric.GetPolicyViolationChart(context.Background(), client.New(server.URL), metric.QueryOptions{Clusters: []string{"c1"}})
+	if err != nil {
+		t.Fatalf("unexpected error - %s", err)
+	}
+	if len(chart.Series) != 3 || chart.Series[0].Data[0] != 3 || chart.Series[1].Data[0] != 2 {
+		t.Errorf("unexpected chart %+v", chart)
+	}
+}